@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// groupsEnabled is turned off when repositories run in parallel, since the
+// runner cannot attribute interleaved lines to the right group.
+var groupsEnabled = true
+
+// groupOpen is set while a group is open. The runner does not nest groups,
+// so stages run inside another one, such as regenerate commands during a
+// merge, stay in the outer group.
+var groupOpen bool
+
+// inActions reports whether workflow commands will be interpreted.
+func inActions() bool {
+	return os.Getenv("GITHUB_ACTIONS") == "true"
+}
+
+// group runs fn inside a collapsible ::group:: block, unless one is already
+// open.
+func group(title string, fn func() error) error {
+	if !inActions() || !groupsEnabled || groupOpen {
+		return fn()
+	}
+	workflowCommand("group", "", title)
+	groupOpen = true
+	defer func() {
+		groupOpen = false
+		workflowCommand("endgroup", "", "")
+	}()
+	return fn()
+}
+
+// notice reports a skip or no-op outcome.
+func notice(message string) {
+	if !inActions() {
+		log.Println(message)
+		return
+	}
+	workflowCommand("notice", "", message)
+}
+
+// annotateError reports a failure as an ::error:: annotation titled with the
+// stage that produced it.
+func annotateError(err error) {
+	stage := ""
+	var stageErr *StageError
+	if errors.As(err, &stageErr) {
+		stage = stageErr.Stage
+	}
+	if !inActions() {
+		log.Println(err)
+		return
+	}
+	props := ""
+	if stage != "" {
+		props = "title=" + escapeProperty("Stage "+stage)
+	}
+	workflowCommand("error", props, err.Error())
+}
+
+// workflowCommand writes a ::command:: line straight to stdout; log's
+// timestamp prefix would stop the runner from recognising it.
+func workflowCommand(command, props, message string) {
+	line := "::" + command
+	if props != "" {
+		line += " " + props
+	}
+	line += "::" + escapeData(redact(message))
+	fmt.Fprintln(os.Stdout, line)
+}
+
+func escapeData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+func escapeProperty(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(redact(s))
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"io"
+	"os"
+	"testing"
+)
+
+func TestGroupDoesNotNest(t *testing.T) {
+	t.Setenv("GITHUB_ACTIONS", "true")
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	err = group("outer", func() error {
+		return runStage("commands", "inner", func() error { return nil })
+	})
+	w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "::group::outer\n::endgroup::\n"
+	if got := string(out); got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+	if groupOpen {
+		t.Error("group left open")
+	}
+}
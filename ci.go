@@ -0,0 +1,143 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// CIFailureError reports which statuses and check runs failed for a commit.
+type CIFailureError struct {
+	State    string
+	SHA      string
+	Failures []CIFailure
+}
+
+// CIFailure is a single failing status or check run.
+type CIFailure struct {
+	Context     string
+	Description string
+	TargetURL   string
+}
+
+func (e *CIFailureError) Error() string {
+	if len(e.Failures) == 0 {
+		return fmt.Sprintf("ci reported %s", e.State)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "ci reported %s:", e.State)
+	for _, f := range e.Failures {
+		b.WriteString("\n  - ")
+		b.WriteString(f.String())
+	}
+	return b.String()
+}
+
+func (f CIFailure) String() string {
+	s := f.Context
+	if f.Description != "" {
+		s += ": " + f.Description
+	}
+	if f.TargetURL != "" {
+		s += " (" + f.TargetURL + ")"
+	}
+	return s
+}
+
+// Markdown renders the failure as a PR comment.
+func (e *CIFailureError) Markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "CI reported **%s** for %s, so this PR was not merged.\n", e.State, e.SHA)
+	if len(e.Failures) == 0 {
+		b.WriteString("\nNo individual failing checks were reported.\n")
+		return b.String()
+	}
+	b.WriteString("\n| Check | Description |\n| --- | --- |\n")
+	for _, f := range e.Failures {
+		name := markdownCell(f.Context)
+		if f.TargetURL != "" {
+			name = fmt.Sprintf("[%s](%s)", name, f.TargetURL)
+		}
+		fmt.Fprintf(&b, "| %s | %s |\n", name, markdownCell(f.Description))
+	}
+	return b.String()
+}
+
+// markdownCell escapes text for a Markdown table cell, where a pipe or a
+// line break would end the cell or the row.
+func markdownCell(s string) string {
+	s = strings.NewReplacer("\r\n", " ", "\n", " ").Replace(strings.TrimSpace(s))
+	return strings.ReplaceAll(s, "|", "\\|")
+}
+
+// newCIFailure collects the failing statuses and check runs behind a failed combined status.
+func newCIFailure(client *GitHubClient, sha, state string, status *CombinedStatus) *CIFailureError {
+	ciErr := &CIFailureError{State: state, SHA: sha}
+	for _, s := range status.Statuses {
+		switch strings.ToLower(s.State) {
+		case "failure", "error":
+			ciErr.Failures = append(ciErr.Failures, CIFailure{
+				Context:     s.Context,
+				Description: s.Description,
+				TargetURL:   s.TargetURL,
+			})
+		}
+	}
+
+	runs, err := client.ListCheckRuns(sha)
+	if err != nil {
+		log.Printf("Failed to list check runs for %s: %v\n", sha, err)
+		return ciErr
+	}
+	for _, run := range runs {
+		if !checkRunFailed(run) {
+			continue
+		}
+		targetURL := run.HTMLURL
+		if targetURL == "" {
+			targetURL = run.DetailsURL
+		}
+		ciErr.Failures = append(ciErr.Failures, CIFailure{
+			Context:     run.Name,
+			Description: firstNonEmpty(run.Output.Title, run.Conclusion),
+			TargetURL:   targetURL,
+		})
+	}
+	return ciErr
+}
+
+func checkRunFailed(run CheckRun) bool {
+	switch strings.ToLower(run.Conclusion) {
+	case "failure", "timed_out", "cancelled", "action_required", "startup_failure":
+		return true
+	}
+	return false
+}
+
+// ReportCIFailure comments the failing checks on the PR and, when configured,
+// closes the PR and deletes its branch. Errors are logged rather than returned
+// so the original CI error is what the run fails with.
+func ReportCIFailure(cfg config, client *GitHubClient, pr *PullRequest, ciErr error) {
+	var failure *CIFailureError
+	if !errors.As(ciErr, &failure) {
+		return
+	}
+
+	if err := client.CreateComment(pr.Number, redact(failure.Markdown())); err != nil {
+		log.Printf("Failed to comment on PR #%d: %v\n", pr.Number, err)
+	}
+
+	if !cfg.CloseOnCIFailure {
+		return
+	}
+	if err := client.ClosePullRequest(pr.Number); err != nil {
+		log.Printf("Failed to close PR #%d: %v\n", pr.Number, err)
+		return
+	}
+	if err := client.DeleteBranch(pr.Head.Ref); err != nil {
+		log.Printf("Failed to delete branch %s: %v\n", pr.Head.Ref, err)
+		return
+	}
+	log.Printf("Closed PR #%d and deleted %s after CI failure.\n", pr.Number, pr.Head.Ref)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestCheckRunFailed(t *testing.T) {
+	tests := []struct {
+		conclusion string
+		want       bool
+	}{
+		{"failure", true},
+		{"timed_out", true},
+		{"cancelled", true},
+		{"action_required", true},
+		{"startup_failure", true},
+		{"FAILURE", true},
+		{"success", false},
+		{"neutral", false},
+		{"skipped", false},
+		{"stale", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := checkRunFailed(CheckRun{Conclusion: tt.conclusion}); got != tt.want {
+			t.Errorf("checkRunFailed(%q) = %v, want %v", tt.conclusion, got, tt.want)
+		}
+	}
+}
+
+func TestNewCIFailure(t *testing.T) {
+	client := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/owner/repo/commits/abc123/check-runs" {
+			t.Errorf("unexpected request %s", r.URL.Path)
+		}
+		json.NewEncoder(w).Encode(CheckRunList{CheckRuns: []CheckRun{
+			{Name: "build", Conclusion: "success"},
+			{Name: "lint", Conclusion: "failure", HTMLURL: "https://example.com/lint", Output: CheckRunOutput{Title: "2 errors"}},
+			{Name: "e2e", Conclusion: "timed_out", DetailsURL: "https://example.com/e2e"},
+			{Name: "docs", Conclusion: "skipped"},
+			{Name: "optional", Conclusion: "neutral"},
+		}})
+	})
+	status := &CombinedStatus{Statuses: []Status{
+		{Context: "ci/legacy", State: "error", Description: "crashed"},
+		{Context: "ci/ok", State: "success"},
+		{Context: "ci/running", State: "pending"},
+	}}
+
+	got := newCIFailure(client, "abc123", "failure", status)
+	want := []CIFailure{
+		{Context: "ci/legacy", Description: "crashed"},
+		{Context: "lint", Description: "2 errors", TargetURL: "https://example.com/lint"},
+		{Context: "e2e", Description: "timed_out", TargetURL: "https://example.com/e2e"},
+	}
+	if len(got.Failures) != len(want) {
+		t.Fatalf("newCIFailure() failures = %+v, want %+v", got.Failures, want)
+	}
+	for i := range want {
+		if got.Failures[i] != want[i] {
+			t.Errorf("failure %d = %+v, want %+v", i, got.Failures[i], want[i])
+		}
+	}
+}
+
+func TestCIFailureMarkdown(t *testing.T) {
+	tests := []struct {
+		name    string
+		failure CIFailure
+		want    string
+	}{
+		{name: "plain", failure: CIFailure{Context: "lint", Description: "2 errors"}, want: "| lint | 2 errors |\n"},
+		{
+			name:    "linked",
+			failure: CIFailure{Context: "lint", TargetURL: "https://example.com/lint"},
+			want:    "| [lint](https://example.com/lint) |  |\n",
+		},
+		{name: "pipe", failure: CIFailure{Context: "a|b", Description: "x | y"}, want: "| a\\|b | x \\| y |\n"},
+		{name: "newlines", failure: CIFailure{Context: "test", Description: "first\nsecond\r\nthird\n"}, want: "| test | first second third |\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &CIFailureError{State: "failure", SHA: "abc123", Failures: []CIFailure{tt.failure}}
+			got := e.Markdown()
+			if !strings.HasSuffix(got, "| --- | --- |\n"+tt.want) {
+				t.Errorf("Markdown() = %q, want it to end with row %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+const defaultCleanupComment = "Closing stale automated pull request; its branch is being removed by cleanup."
+
+type cleanupConfig struct {
+	Prefix    string
+	OlderThan time.Duration
+	DryRun    bool
+	Comment   string
+}
+
+// RunCleanup closes open PRs and deletes branches left behind by old runs.
+func RunCleanup(args []string) error {
+	cleanupCfg, err := parseCleanupFlags(args)
+	if err != nil {
+		return err
+	}
+
+	token, err := loadAccessToken()
+	if err != nil {
+		return err
+	}
+	registerSecret(token)
+	owner, name, err := loadRepository()
+	if err != nil {
+		return err
+	}
+	client := NewGitHubClient(token, owner, name)
+
+	refs, err := client.ListMatchingRefs("heads/" + cleanupCfg.Prefix)
+	if err != nil {
+		return fmt.Errorf("failed to list branches: %w", err)
+	}
+	log.Printf("Found %d branches matching %q.\n", len(refs), cleanupCfg.Prefix)
+
+	cutoff := time.Now().Add(-cleanupCfg.OlderThan)
+	var failures int
+	for _, ref := range refs {
+		branch := strings.TrimPrefix(ref.Ref, "refs/heads/")
+
+		commit, err := client.GetCommit(ref.Object.SHA)
+		if err != nil {
+			log.Printf("Skipping %s: failed to fetch head commit: %v\n", branch, err)
+			failures++
+			continue
+		}
+		lastUpdated := commit.Commit.Committer.Date
+		if lastUpdated.After(cutoff) {
+			log.Printf("Keeping %s: last updated %s.\n", branch, lastUpdated.Format(time.RFC3339))
+			continue
+		}
+
+		if err := cleanupBranch(client, cleanupCfg, branch, lastUpdated); err != nil {
+			log.Printf("Failed to clean up %s: %v\n", branch, err)
+			failures++
+		}
+	}
+
+	if failures > 0 {
+		return fmt.Errorf("cleanup finished with %d failures", failures)
+	}
+	return nil
+}
+
+func cleanupBranch(client *GitHubClient, cleanupCfg cleanupConfig, branch string, lastUpdated time.Time) error {
+	prs, err := client.ListPullRequestsForBranch(branch, "open")
+	if err != nil {
+		return fmt.Errorf("failed to list pull requests: %w", err)
+	}
+
+	if cleanupCfg.DryRun {
+		for _, pr := range prs {
+			log.Printf("[dry-run] Would close PR #%d (%s).\n", pr.Number, pr.HTMLURL)
+		}
+		log.Printf("[dry-run] Would delete %s (last updated %s).\n", branch, lastUpdated.Format(time.RFC3339))
+		return nil
+	}
+
+	for _, pr := range prs {
+		if err := client.CreateComment(pr.Number, cleanupCfg.Comment); err != nil {
+			return fmt.Errorf("failed to comment on PR #%d: %w", pr.Number, err)
+		}
+		if err := client.ClosePullRequest(pr.Number); err != nil {
+			return fmt.Errorf("failed to close PR #%d: %w", pr.Number, err)
+		}
+		log.Printf("Closed PR #%d.\n", pr.Number)
+	}
+
+	if err := client.DeleteBranch(branch); err != nil {
+		return fmt.Errorf("failed to delete branch: %w", err)
+	}
+	log.Printf("Deleted %s.\n", branch)
+	return nil
+}
+
+func parseCleanupFlags(args []string) (cleanupConfig, error) {
+	var cleanupCfg cleanupConfig
+	fs := flag.NewFlagSet("cleanup", flag.ContinueOnError)
+	fs.StringVar(&cleanupCfg.Prefix, "prefix", "auto-merge-", "branch name prefix to clean up")
+	fs.DurationVar(&cleanupCfg.OlderThan, "older-than", 7*24*time.Hour, "only clean up branches whose head commit is older than this")
+	fs.BoolVar(&cleanupCfg.DryRun, "dry-run", false, "list what would be closed and deleted without changing anything")
+	fs.StringVar(&cleanupCfg.Comment, "comment", defaultCleanupComment, "comment posted on each PR before it is closed")
+	if err := fs.Parse(args); err != nil {
+		return cleanupConfig{}, err
+	}
+
+	if strings.TrimSpace(cleanupCfg.Prefix) == "" {
+		return cleanupConfig{}, errors.New("cleanup prefix must not be empty")
+	}
+	if cleanupCfg.OlderThan < 0 {
+		return cleanupConfig{}, fmt.Errorf("invalid -older-than: %s", cleanupCfg.OlderThan)
+	}
+	return cleanupCfg, nil
+}
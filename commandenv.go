@@ -0,0 +1,70 @@
+package main
+
+import (
+	"os"
+	"strings"
+)
+
+// defaultCommandEnv is passed to commands unless scrubbed. Entries ending in
+// "*" match by prefix. Of the GITHUB_ variables only the read-only context
+// is included: the file commands (GITHUB_ENV, GITHUB_OUTPUT, GITHUB_PATH,
+// GITHUB_STATE, GITHUB_STEP_SUMMARY) would let commands change later steps,
+// so they need to be opted into with command_env.
+var defaultCommandEnv = []string{
+	"PATH", "HOME", "USER", "LOGNAME", "SHELL", "TERM", "LANG", "LC_*", "TZ", "TMPDIR", "HOSTNAME",
+	"CI", "RUNNER_*", "ImageOS", "ImageVersion",
+	"GOPATH", "GOROOT", "GOFLAGS", "GOPROXY", "GOPRIVATE", "GONOPROXY", "GONOSUMDB",
+	"GOCACHE", "GOMODCACHE", "GOTOOLCHAIN", "GOOS", "GOARCH",
+	"GITHUB_ACTIONS", "GITHUB_ACTOR", "GITHUB_ACTOR_ID", "GITHUB_API_URL", "GITHUB_GRAPHQL_URL", "GITHUB_SERVER_URL",
+	"GITHUB_REPOSITORY", "GITHUB_REPOSITORY_ID", "GITHUB_REPOSITORY_OWNER", "GITHUB_REPOSITORY_OWNER_ID",
+	"GITHUB_SHA", "GITHUB_REF", "GITHUB_REF_NAME", "GITHUB_REF_TYPE", "GITHUB_BASE_REF", "GITHUB_HEAD_REF",
+	"GITHUB_EVENT_NAME", "GITHUB_EVENT_PATH", "GITHUB_WORKFLOW", "GITHUB_WORKFLOW_REF", "GITHUB_JOB",
+	"GITHUB_RUN_ID", "GITHUB_RUN_NUMBER", "GITHUB_RUN_ATTEMPT", "GITHUB_WORKSPACE",
+}
+
+// deniedCommandEnv never reaches commands, even when allow-listed.
+var deniedCommandEnv = []string{
+	"GITHUB_TOKEN", "GITHUB_ACCESS_TOKEN", "INPUT_GITHUB_ACCESS_TOKEN",
+	"ACTIONS_RUNTIME_TOKEN", "ACTIONS_ID_TOKEN_REQUEST_TOKEN", "ACTIONS_ID_TOKEN_REQUEST_URL",
+}
+
+// commandEnv builds the environment for user commands: the default variables
+// plus cfg.CommandEnv, minus anything holding a token or other registered
+// secret. With cfg.ExposeToken the access token is provided as GITHUB_TOKEN.
+func commandEnv(cfg config) []string {
+	allowed := append(append([]string{}, defaultCommandEnv...), cfg.CommandEnv...)
+	env := filterCommandEnv(os.Environ(), allowed)
+	if cfg.ExposeToken {
+		env = append(env, "GITHUB_TOKEN="+cfg.AccessToken)
+	}
+	return env
+}
+
+// filterCommandEnv keeps the NAME=value entries of environ whose name is
+// allowed and neither denied nor holding a registered secret.
+func filterCommandEnv(environ, allowed []string) []string {
+	var env []string
+	for _, kv := range environ {
+		name, value, _ := strings.Cut(kv, "=")
+		if matchEnvName(deniedCommandEnv, name) || isSecret(value) {
+			continue
+		}
+		if matchEnvName(allowed, name) {
+			env = append(env, kv)
+		}
+	}
+	return env
+}
+
+func matchEnvName(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if prefix, ok := strings.CutSuffix(p, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if p == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFilterCommandEnv(t *testing.T) {
+	withSecrets(t, "ghp_supersecret")
+
+	environ := []string{
+		"PATH=/usr/bin",
+		"LC_ALL=C",
+		"GOPATH=/go",
+		"GOOGLE_APPLICATION_CREDENTIALS=/tmp/gha-creds.json",
+		"GITHUB_SHA=abc123",
+		"GITHUB_ENV=/runner/env",
+		"GITHUB_OUTPUT=/runner/output",
+		"GITHUB_TOKEN=ghs_token",
+		"MY_VAR=1",
+		"MY_SECRET=ghp_supersecret",
+		"EXTRA_A=a",
+		"OTHER=x",
+	}
+	tests := []struct {
+		name  string
+		extra []string
+		want  []string
+	}{
+		{
+			name: "defaults",
+			want: []string{"PATH=/usr/bin", "LC_ALL=C", "GOPATH=/go", "GITHUB_SHA=abc123"},
+		},
+		{
+			name:  "opted in",
+			extra: []string{"GITHUB_ENV", "MY_*", "EXTRA_A"},
+			want:  []string{"PATH=/usr/bin", "LC_ALL=C", "GOPATH=/go", "GITHUB_SHA=abc123", "GITHUB_ENV=/runner/env", "MY_VAR=1", "EXTRA_A=a"},
+		},
+		{
+			name:  "denied even when allowed",
+			extra: []string{"GITHUB_*"},
+			want:  []string{"PATH=/usr/bin", "LC_ALL=C", "GOPATH=/go", "GITHUB_SHA=abc123", "GITHUB_ENV=/runner/env", "GITHUB_OUTPUT=/runner/output"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allowed := append(append([]string{}, defaultCommandEnv...), tt.extra...)
+			if got := filterCommandEnv(environ, allowed); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("filterCommandEnv() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ConflictStrategy resolves merge conflicts in paths matching Pattern.
+// Action is "ours" (keep the target branch's version), "theirs" (take the
+// base branch's version) or "regenerate" (take the base branch's version,
+// then run Command).
+type ConflictStrategy struct {
+	Pattern string
+	Action  string
+	Command string
+}
+
+// Label describes the strategy in PR bodies and logs.
+func (s ConflictStrategy) Label() string {
+	if s.Action == "regenerate" {
+		return fmt.Sprintf("regenerated with `%s`", s.Command)
+	}
+	return s.Action
+}
+
+// conflictResolution records the strategy applied to one conflicting path.
+type conflictResolution struct {
+	Path     string
+	Strategy ConflictStrategy
+}
+
+// parseConflictStrategies reads one "<glob>: <action> [command]" entry per
+// line. Commas are not separators because commands may contain them.
+func parseConflictStrategies(raw string) ([]ConflictStrategy, error) {
+	var strategies []ConflictStrategy
+	for _, line := range strings.Split(raw, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		pattern, rest, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid conflict strategy %q: expected <glob>: <strategy>", line)
+		}
+		action, command, _ := strings.Cut(strings.TrimSpace(rest), " ")
+		strategy := ConflictStrategy{
+			Pattern: strings.TrimSpace(pattern),
+			Action:  strings.ToLower(action),
+			Command: strings.TrimSpace(command),
+		}
+		if strategy.Pattern == "" {
+			return nil, fmt.Errorf("invalid conflict strategy %q: missing glob", line)
+		}
+		switch strategy.Action {
+		case "ours", "theirs":
+			if strategy.Command != "" {
+				return nil, fmt.Errorf("invalid conflict strategy %q: %s takes no command", line, strategy.Action)
+			}
+		case "regenerate":
+			if strategy.Command == "" {
+				return nil, fmt.Errorf("invalid conflict strategy %q: regenerate needs a command", line)
+			}
+		default:
+			return nil, fmt.Errorf("invalid conflict strategy %q: unknown strategy %s", line, action)
+		}
+		strategies = append(strategies, strategy)
+	}
+	return strategies, nil
+}
+
+// strategyFor returns the first strategy whose glob matches path.
+func strategyFor(strategies []ConflictStrategy, path string) (ConflictStrategy, bool) {
+	for _, s := range strategies {
+		if matchGlob(s.Pattern, path) {
+			return s, true
+		}
+	}
+	return ConflictStrategy{}, false
+}
+
+// resolveConflicts applies the configured strategies to the conflicting
+// paths of an in-progress merge and returns what it resolved and what is
+// left. Regeneration commands run once each, after every path has been
+// resolved to one side, and everything they change is staged.
+func resolveConflicts(cfg config, conflicts []string) ([]conflictResolution, []string, error) {
+	var resolved []conflictResolution
+	var remaining []string
+	var commands []string
+	seen := map[string]bool{}
+	for _, path := range conflicts {
+		strategy, ok := strategyFor(cfg.ConflictStrategies, path)
+		if !ok {
+			remaining = append(remaining, path)
+			continue
+		}
+
+		side := "--theirs"
+		if strategy.Action == "ours" {
+			side = "--ours"
+		}
+		if err := runGit(cfg.WorkDir, "checkout", side, "--", path); err != nil {
+			// The chosen side deleted the file.
+			if err := runGit(cfg.WorkDir, "rm", "--quiet", "--", path); err != nil {
+				return nil, nil, fmt.Errorf("failed to resolve %s: %w", path, err)
+			}
+		} else if err := runGit(cfg.WorkDir, "add", "--", path); err != nil {
+			return nil, nil, fmt.Errorf("failed to resolve %s: %w", path, err)
+		}
+
+		if strategy.Command != "" && !seen[strategy.Command] {
+			seen[strategy.Command] = true
+			commands = append(commands, strategy.Command)
+		}
+		resolved = append(resolved, conflictResolution{Path: path, Strategy: strategy})
+	}
+
+	if len(commands) > 0 {
+		regenCfg := cfg
+		regenCfg.Commands = commands
+		if err := RunCommands(regenCfg); err != nil {
+			return nil, nil, err
+		}
+		// Left-over conflicts are either committed with their markers or the
+		// merge is aborted, so staging everything is safe.
+		if err := runGit(cfg.WorkDir, "add", "--all"); err != nil {
+			return nil, nil, fmt.Errorf("failed to stage regenerated files: %w", err)
+		}
+	}
+	return resolved, remaining, nil
+}
+
+// resolutionReport lists resolutions as Markdown under heading.
+func resolutionReport(heading string, resolved []conflictResolution) string {
+	if len(resolved) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "\n%s\n\n", heading)
+	for _, r := range resolved {
+		fmt.Fprintf(&b, "- `%s`: %s\n", r.Path, r.Strategy.Label())
+	}
+	return b.String()
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseConflictStrategies(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    []ConflictStrategy
+		wantErr bool
+	}{
+		{name: "empty", raw: "", want: nil},
+		{
+			name: "all actions",
+			raw:  "# comment\nCHANGELOG.md: ours\n*.lock: THEIRS\n\ngo.sum: regenerate go mod tidy, again\n",
+			want: []ConflictStrategy{
+				{Pattern: "CHANGELOG.md", Action: "ours"},
+				{Pattern: "*.lock", Action: "theirs"},
+				{Pattern: "go.sum", Action: "regenerate", Command: "go mod tidy, again"},
+			},
+		},
+		{name: "missing separator", raw: "go.sum ours", wantErr: true},
+		{name: "missing glob", raw: ": ours", wantErr: true},
+		{name: "command on ours", raw: "a: ours make", wantErr: true},
+		{name: "regenerate without command", raw: "a: regenerate", wantErr: true},
+		{name: "unknown action", raw: "a: mine", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseConflictStrategies(tt.raw)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseConflictStrategies() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseConflictStrategies() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+const contextEnvPrefix = "MERGE_FROM_MAIN_"
+
+// zeroSHA is the "before" of a push that created the branch.
+const zeroSHA = "0000000000000000000000000000000000000000"
+
+// readEventPayload decodes the workflow event, returning an empty payload
+// outside of Actions.
+func readEventPayload() (EventPayload, error) {
+	var event EventPayload
+	path := os.Getenv("GITHUB_EVENT_PATH")
+	if path == "" {
+		return event, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return event, fmt.Errorf("failed to read event payload: %w", err)
+	}
+	if err := json.Unmarshal(data, &event); err != nil {
+		return event, fmt.Errorf("failed to decode event payload: %w", err)
+	}
+	return event, nil
+}
+
+// withPushContext records the triggering and previous SHAs and writes the
+// paths changed by the push to a temporary file for commands to read. The
+// returned function removes that file.
+func withPushContext(cfg config) (config, func(), error) {
+	noop := func() {}
+	if cfg.RepoOwner+"/"+cfg.RepoName != os.Getenv("GITHUB_REPOSITORY") {
+		// In multi-repository mode the push happened in another repository.
+		return cfg, noop, nil
+	}
+
+	event, err := readEventPayload()
+	if err != nil {
+		return cfg, noop, err
+	}
+	cfg.TriggerSHA = firstNonEmpty(os.Getenv("GITHUB_SHA"), event.After)
+	if event.PullRequest != nil {
+		// GITHUB_SHA is the test merge commit on pull request events.
+		cfg.TriggerSHA = event.PullRequest.Head.Sha
+	}
+	if cfg.TriggerSHA == "" {
+		if cfg.TriggerSHA, err = gitHeadSHA(cfg.WorkDir); err != nil {
+			return cfg, noop, err
+		}
+	}
+	if event.Before != zeroSHA {
+		cfg.BeforeSHA = event.Before
+	}
+
+	files, err := pushChangedFiles(cfg)
+	if err != nil {
+		return cfg, noop, err
+	}
+
+	f, err := os.CreateTemp(os.Getenv("RUNNER_TEMP"), "changed-files-*.txt")
+	if err != nil {
+		return cfg, noop, fmt.Errorf("failed to create changed files list: %w", err)
+	}
+	content := strings.Join(files, "\n")
+	if content != "" {
+		content += "\n"
+	}
+	if _, err := f.WriteString(content); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return cfg, noop, fmt.Errorf("failed to write changed files list: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return cfg, noop, fmt.Errorf("failed to write changed files list: %w", err)
+	}
+	cfg.ChangedFilesPath = f.Name()
+	return cfg, func() { os.Remove(f.Name()) }, nil
+}
+
+// pushChangedFiles lists the paths changed between BeforeSHA and TriggerSHA.
+// Shallow checkouts may lack either commit, so they are fetched when missing.
+// Without a usable previous commit, only the triggering commit's own changes
+// are listed.
+func pushChangedFiles(cfg config) ([]string, error) {
+	ensureCommit(cfg, cfg.TriggerSHA)
+	if cfg.BeforeSHA != "" {
+		ensureCommit(cfg, cfg.BeforeSHA)
+		out, err := gitOutput(cfg.WorkDir, "diff", "--name-only", cfg.BeforeSHA, cfg.TriggerSHA)
+		if err == nil {
+			return splitLines(string(out)), nil
+		}
+		log.Printf("Failed to diff %s..%s; listing only the triggering commit's changes.\n", cfg.BeforeSHA, cfg.TriggerSHA)
+	}
+
+	out, err := gitOutput(cfg.WorkDir, "diff-tree", "--no-commit-id", "--name-only", "-r", "--root", cfg.TriggerSHA)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list changes in %s: %w", cfg.TriggerSHA, err)
+	}
+	return splitLines(string(out)), nil
+}
+
+// ensureCommit fetches sha unless it is already present. Failures are only
+// logged; the git command that needs the commit reports the error.
+func ensureCommit(cfg config, sha string) {
+	if _, err := gitOutput(cfg.WorkDir, "cat-file", "-e", sha+"^{commit}"); err == nil {
+		return
+	}
+	if err := runGitRemote(cfg, cfg.WorkDir, "fetch", "--depth=1", "origin", sha); err != nil {
+		log.Printf("Failed to fetch commit %s: %v\n", sha, err)
+	}
+}
+
+// contextEnv exposes the pipeline state to commands.
+func contextEnv(cfg config) []string {
+	vars := []struct{ name, value string }{
+		{"BASE_BRANCH", cfg.BaseBranch},
+		{"BASE_SHA", cfg.BaseSHA},
+		{"SHA", cfg.TriggerSHA},
+		{"BEFORE_SHA", cfg.BeforeSHA},
+		{"CHANGED_FILES", cfg.ChangedFilesPath},
+		{"WORK_BRANCH", cfg.WorkBranch},
+	}
+	env := make([]string, 0, len(vars))
+	for _, v := range vars {
+		env = append(env, contextEnvPrefix+v.name+"="+v.value)
+	}
+	return env
+}
+
+func splitLines(s string) []string {
+	var lines []string
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
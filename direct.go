@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+)
+
+// errDirectFallback means the changes should go through a PR after all.
+// They are left uncommitted on top of the returned base SHA.
+var errDirectFallback = errors.New("falling back to a pull request")
+
+// PushDirect commits the pending changes and pushes them straight to the
+// base branch, leased on baseSHA so a concurrent push is never overwritten.
+// When the base moved, the commands are re-run on its new head, up to
+// cfg.BaseMovedMaxAttempts times. A push refused for any other reason, such
+// as branch protection, returns errDirectFallback. The returned SHA is the
+// base the changes were last made on.
+func PushDirect(cfg config, client *GitHubClient, baseSHA string) (string, string, error) {
+	for attempt := 1; ; attempt++ {
+		var committed bool
+		err := runStage("push", "Push to "+cfg.BaseBranch, func() error {
+			if _, err := commitChanges(cfg); err != nil {
+				return err
+			}
+			committed = true
+			return pushWithLease(cfg, baseSHA)
+		}, "branch", cfg.BaseBranch, "sha", baseSHA)
+		if !committed {
+			// Only a rejected push has a commit to undo or retry.
+			return "", baseSHA, err
+		}
+		if err == nil {
+			log.Printf("Pushed changes directly to %s.\n", cfg.BaseBranch)
+			return OutcomeMerged, baseSHA, nil
+		}
+
+		currentBase, headErr := baseHeadSHA(cfg, client)
+		if headErr != nil {
+			return "", baseSHA, headErr
+		}
+		if currentBase == baseSHA {
+			log.Printf("Direct push to %s was rejected (%v); opening a pull request instead.\n", cfg.BaseBranch, err)
+			if err := runGit(cfg.WorkDir, "reset", "--soft", "HEAD~1"); err != nil {
+				return "", baseSHA, fmt.Errorf("failed to undo commit: %w", err)
+			}
+			return "", baseSHA, errDirectFallback
+		}
+		if attempt >= cfg.BaseMovedMaxAttempts {
+			return "", baseSHA, fmt.Errorf("%s kept moving after %d attempts", cfg.BaseBranch, attempt)
+		}
+
+		log.Printf("%s moved from %s to %s; re-running commands (attempt %d of %d).\n",
+			cfg.BaseBranch, baseSHA, currentBase, attempt, cfg.BaseMovedMaxAttempts)
+		if baseSHA, err = checkoutLatestBase(cfg); err != nil {
+			return "", baseSHA, err
+		}
+		cfg.BaseSHA = baseSHA
+		cfg.WorkBranch = ""
+		if err := RunCommands(cfg); err != nil {
+			return "", baseSHA, err
+		}
+		if cfg.Strict {
+			if err := CheckStrict(cfg); err != nil {
+				return "", baseSHA, err
+			}
+		}
+		changed, err := hasChanges(cfg.WorkDir, cfg.StagePaths...)
+		if err != nil {
+			return "", baseSHA, err
+		}
+		if !changed {
+			notice(fmt.Sprintf("No changes detected on the new %s. Nothing to push.", cfg.BaseBranch))
+			return OutcomeNoChanges, baseSHA, nil
+		}
+		safeguardErr, err := CheckSafeguards(cfg)
+		if err != nil {
+			return "", baseSHA, err
+		}
+		if safeguardErr != nil {
+			if cfg.SafeguardAction == "fail" {
+				return "", baseSHA, safeguardErr
+			}
+			return "", baseSHA, errDirectFallback
+		}
+	}
+}
+
+// pushWithLease pushes HEAD to the base branch only if the branch is still
+// at expectedSHA.
+func pushWithLease(cfg config, expectedSHA string) error {
+	ref := "refs/heads/" + cfg.BaseBranch
+	if err := runGitRemote(cfg, cfg.WorkDir, "push", "--force-with-lease="+ref+":"+expectedSHA, originPushURL(cfg), "HEAD:"+ref); err != nil {
+		return fmt.Errorf("failed to push to %s: %w", cfg.BaseBranch, err)
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"strings"
+)
+
+// Outcomes recorded for each target branch.
+const (
+	OutcomeMerged    = "merged"
+	OutcomeOpened    = "opened"
+	OutcomeNoChanges = "no changes"
+	OutcomeClosed    = "closed"
+	OutcomeSkipped   = "skipped"
+	OutcomeFailed    = "failed"
+	OutcomeUpdated   = "updated"
+	OutcomeUpToDate  = "up to date"
+	OutcomeConflicts = "conflicts"
+)
+
+// TargetResult is the outcome of the pipeline for one base branch.
+type TargetResult struct {
+	Repository string
+	Branch     string
+	Partition  string
+	Outcome    string
+	PR         *PullRequest
+	Err        error
+}
+
+// Label names the branch and, in monorepo mode, the partition.
+func (r TargetResult) Label() string {
+	if r.Partition == "" {
+		return r.Branch
+	}
+	return fmt.Sprintf("%s (%s)", r.Branch, r.Partition)
+}
+
+// ResolveBaseBranches expands cfg.BaseBranches into concrete branch names.
+// Entries containing glob characters are matched against the repository's
+// branches; other entries are used as-is. Without any configured entries the
+// pipeline targets cfg.BaseBranch.
+func ResolveBaseBranches(cfg config, client *GitHubClient) ([]string, error) {
+	if len(cfg.BaseBranches) == 0 {
+		return []string{cfg.BaseBranch}, nil
+	}
+	return resolveBranchPatterns(client, cfg.BaseBranches)
+}
+
+// ResolveMergeTargets expands cfg.MergeTargets into the branches the base
+// branch is merged into, leaving out the base branch itself.
+func ResolveMergeTargets(cfg config, client *GitHubClient) ([]string, error) {
+	branches, err := resolveBranchPatterns(client, cfg.MergeTargets)
+	if err != nil {
+		return nil, err
+	}
+	var targets []string
+	for _, branch := range branches {
+		if branch != cfg.BaseBranch {
+			targets = append(targets, branch)
+		}
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no merge targets other than %s matched %s", cfg.BaseBranch, strings.Join(cfg.MergeTargets, ", "))
+	}
+	return targets, nil
+}
+
+// resolveBranchPatterns matches glob entries against the repository's
+// branches and passes other entries through unchanged.
+func resolveBranchPatterns(client *GitHubClient, patterns []string) ([]string, error) {
+	var branches []BranchInfo
+	seen := map[string]bool{}
+	var resolved []string
+	add := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			resolved = append(resolved, name)
+		}
+	}
+
+	for _, pattern := range patterns {
+		if !strings.ContainsAny(pattern, "*?[") {
+			add(pattern)
+			continue
+		}
+
+		if branches == nil {
+			var err error
+			branches, err = client.ListBranches()
+			if err != nil {
+				return nil, fmt.Errorf("failed to list branches: %w", err)
+			}
+		}
+
+		matched := false
+		for _, branch := range branches {
+			ok, err := path.Match(pattern, branch.Name)
+			if err != nil {
+				return nil, fmt.Errorf("invalid branch pattern %q: %w", pattern, err)
+			}
+			if ok {
+				add(branch.Name)
+				matched = true
+			}
+		}
+		if !matched {
+			log.Printf("Branch pattern %q matched no branches.\n", pattern)
+		}
+	}
+
+	if len(resolved) == 0 {
+		return nil, fmt.Errorf("no branches matched %s", strings.Join(patterns, ", "))
+	}
+	return resolved, nil
+}
+
+// ReportResults logs a per-branch table, appends it to the job summary when
+// available, and returns an error if any branch failed.
+func ReportResults(results []TargetResult) error {
+	if len(results) == 0 {
+		return nil
+	}
+
+	var b strings.Builder
+	b.WriteString("| Repository | Branch | Result | Pull request | Error |\n| --- | --- | --- | --- | --- |\n")
+	failures := 0
+	for _, r := range results {
+		pr := ""
+		if r.PR != nil {
+			pr = fmt.Sprintf("[#%d](%s)", r.PR.Number, r.PR.HTMLURL)
+		}
+		errText := ""
+		if r.Err != nil {
+			failures++
+			errText = strings.ReplaceAll(strings.ReplaceAll(r.Err.Error(), "\n", " "), "|", "\\|")
+		}
+		fmt.Fprintf(&b, "| %s | %s | %s | %s | %s |\n", r.Repository, r.Label(), r.Outcome, pr, errText)
+	}
+
+	if len(results) > 1 {
+		log.Printf("Results:\n%s", b.String())
+	}
+	if summaryPath := os.Getenv("GITHUB_STEP_SUMMARY"); summaryPath != "" {
+		if err := appendFile(summaryPath, redact("### Merge from main\n\n"+b.String())); err != nil {
+			log.Printf("Failed to write job summary: %v\n", err)
+		}
+	}
+
+	if failures > 0 {
+		return fmt.Errorf("%d of %d target branches failed", failures, len(results))
+	}
+	return nil
+}
+
+func appendFile(name, content string) error {
+	f, err := os.OpenFile(name, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(content); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	neturl "net/url"
+	"strings"
+	"time"
+)
+
+// parsePushRemote accepts owner/repo or a git URL and returns the URL to
+// push to along with the owner and name of the repository it points at.
+// owner/repo becomes an SSH URL when useSSH is set.
+func parsePushRemote(raw string, useSSH bool) (string, string, string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", "", "", nil
+	}
+
+	var repoPath string
+	pushURL := raw
+	switch {
+	case strings.Contains(raw, "://"):
+		u, err := neturl.Parse(raw)
+		if err != nil {
+			return "", "", "", fmt.Errorf("invalid push_remote %q: %w", raw, err)
+		}
+		repoPath = u.Path
+	case strings.HasPrefix(raw, "git@"):
+		_, repoPath, _ = strings.Cut(raw, ":")
+	default:
+		repoPath = raw
+		pushURL = fmt.Sprintf("https://github.com/%s.git", strings.TrimSuffix(raw, ".git"))
+		if useSSH {
+			pushURL = fmt.Sprintf("git@github.com:%s.git", strings.TrimSuffix(raw, ".git"))
+		}
+	}
+
+	parts := strings.Split(strings.TrimSuffix(strings.Trim(repoPath, "/"), ".git"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", "", fmt.Errorf("invalid push_remote %q: expected owner/repo or a repository URL", raw)
+	}
+	return pushURL, parts[0], parts[1], nil
+}
+
+// pushesToFork reports whether PR branches are pushed to a repository other
+// than the one the PRs are opened in.
+func pushesToFork(cfg config) bool {
+	return cfg.PushOwner != "" && !strings.EqualFold(cfg.PushOwner+"/"+cfg.PushRepo, cfg.RepoOwner+"/"+cfg.RepoName)
+}
+
+// prHead names a pushed branch the way the pulls API expects: owner:branch
+// when it lives in a fork.
+func prHead(cfg config, branch string) string {
+	if pushesToFork(cfg) {
+		return cfg.PushOwner + ":" + branch
+	}
+	return branch
+}
+
+// EnsureFork makes sure the push remote exists as a fork of the repository,
+// creating it when missing, and syncs the fork's copies of the target
+// branches.
+func EnsureFork(cfg config, client *GitHubClient, branches []string) error {
+	fork := NewGitHubClient(cfg.AccessToken, cfg.PushOwner, cfg.PushRepo)
+	repo, err := fork.GetRepository()
+	if isAPIStatus(err, http.StatusNotFound) {
+		// Forks go to the token's own account unless an organization is named.
+		organization := cfg.PushOwner
+		if user, err := client.GetAuthenticatedUser(); err == nil && strings.EqualFold(user.Login, cfg.PushOwner) {
+			organization = ""
+		}
+		log.Printf("Creating fork %s/%s.\n", cfg.PushOwner, cfg.PushRepo)
+		if _, err := client.CreateFork(organization, cfg.PushRepo); err != nil {
+			return fmt.Errorf("failed to fork %s/%s into %s: %w", cfg.RepoOwner, cfg.RepoName, cfg.PushOwner, err)
+		}
+		repo, err = waitForRepository(cfg, fork)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to fetch fork %s/%s: %w", cfg.PushOwner, cfg.PushRepo, err)
+	}
+	if !repo.Fork || repo.Parent == nil || !strings.EqualFold(repo.Parent.FullName, cfg.RepoOwner+"/"+cfg.RepoName) {
+		return fmt.Errorf("%s is not a fork of %s/%s", repo.FullName, cfg.RepoOwner, cfg.RepoName)
+	}
+
+	for _, branch := range branches {
+		if err := fork.MergeUpstream(branch); err != nil {
+			// Pushing works without a synced fork; only the fork's own view is stale.
+			log.Printf("Failed to sync %s in fork %s: %v\n", branch, repo.FullName, err)
+		}
+	}
+	return nil
+}
+
+// waitForRepository polls until a newly created fork is available.
+func waitForRepository(cfg config, fork *GitHubClient) (*Repository, error) {
+	interval := cfg.CIWaitInterval
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	deadline := time.Now().Add(5 * time.Minute)
+	for {
+		repo, err := fork.GetRepository()
+		if err == nil {
+			return repo, nil
+		}
+		if !isAPIStatus(err, http.StatusNotFound) || time.Now().After(deadline) {
+			return nil, err
+		}
+		time.Sleep(interval)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import "testing"
+
+func TestParsePushRemote(t *testing.T) {
+	tests := []struct {
+		raw                      string
+		useSSH                   bool
+		wantURL, wantOwner, want string
+		wantErr                  bool
+	}{
+		{raw: "", wantURL: ""},
+		{raw: "bot/repo", wantURL: "https://github.com/bot/repo.git", wantOwner: "bot", want: "repo"},
+		{raw: "bot/repo.git", useSSH: true, wantURL: "git@github.com:bot/repo.git", wantOwner: "bot", want: "repo"},
+		{raw: "https://github.com/bot/repo.git", wantURL: "https://github.com/bot/repo.git", wantOwner: "bot", want: "repo"},
+		{raw: "git@github.com:bot/repo.git", wantURL: "git@github.com:bot/repo.git", wantOwner: "bot", want: "repo"},
+		{raw: "bot", wantErr: true},
+		{raw: "https://github.com/bot", wantErr: true},
+	}
+	for _, tt := range tests {
+		url, owner, repo, err := parsePushRemote(tt.raw, tt.useSSH)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parsePushRemote(%q) error = %v, wantErr %v", tt.raw, err, tt.wantErr)
+			continue
+		}
+		if url != tt.wantURL || owner != tt.wantOwner || repo != tt.want {
+			t.Errorf("parsePushRemote(%q) = %q, %q, %q, want %q, %q, %q", tt.raw, url, owner, repo, tt.wantURL, tt.wantOwner, tt.want)
+		}
+	}
+}
+
+func TestPRHead(t *testing.T) {
+	cfg := config{RepoOwner: "org", RepoName: "repo"}
+	if got := prHead(cfg, "auto-merge-1"); got != "auto-merge-1" {
+		t.Errorf("prHead() without fork = %q", got)
+	}
+	cfg.PushOwner, cfg.PushRepo = "ORG", "REPO"
+	if got := prHead(cfg, "auto-merge-1"); got != "auto-merge-1" {
+		t.Errorf("prHead() with the repository itself as remote = %q", got)
+	}
+	cfg.PushOwner = "bot"
+	if got := prHead(cfg, "auto-merge-1"); got != "bot:auto-merge-1" {
+		t.Errorf("prHead() with fork = %q", got)
+	}
+}
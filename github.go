@@ -3,9 +3,12 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	neturl "net/url"
+	"strings"
 )
 
 const (
@@ -100,15 +103,17 @@ func (c *GitHubClient) GetCombinedStatus(sha string) (*CombinedStatus, error) {
 	return &status, nil
 }
 
-// MergePullRequest merges a pull request using squash strategy.
-func (c *GitHubClient) MergePullRequest(prNumber int, prTitle, prMessage string) (bool, error) {
+// MergePullRequest merges a pull request with the given method. When sha is
+// set, GitHub refuses the merge unless it matches the PR head.
+func (c *GitHubClient) MergePullRequest(prNumber int, prTitle, prMessage, sha, method string) (bool, error) {
 	url := fmt.Sprintf("%s/repos/%s/%s/pulls/%d/merge",
 		githubAPIBaseURL, c.repoOwner, c.repo, prNumber)
 
 	mergeReq := MergeRequest{
 		CommitTitle:   prTitle,
 		CommitMessage: prMessage,
-		MergeMethod:   "squash",
+		Sha:           sha,
+		MergeMethod:   method,
 	}
 
 	jsonData, err := json.Marshal(mergeReq)
@@ -151,3 +156,453 @@ func (c *GitHubClient) decorateHeaders(req *http.Request) {
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.token))
 	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
 }
+
+// ListMatchingRefs returns every ref under refs/<prefix>. The endpoint may
+// ignore page parameters and return everything at once, so it follows the
+// Link header and stops when a page adds no new refs.
+func (c *GitHubClient) ListMatchingRefs(prefix string) ([]Ref, error) {
+	var refs []Ref
+	seen := map[string]bool{}
+	url := fmt.Sprintf("%s/repos/%s/%s/git/matching-refs/%s?per_page=%d",
+		githubAPIBaseURL, c.repoOwner, c.repo, prefix, perPage)
+	for url != "" {
+		var batch []Ref
+		header, err := c.doJSONHeader("GET", url, nil, &batch)
+		if err != nil {
+			return nil, err
+		}
+		added := 0
+		for _, ref := range batch {
+			if !seen[ref.Ref] {
+				seen[ref.Ref] = true
+				refs = append(refs, ref)
+				added++
+			}
+		}
+		if added == 0 {
+			break
+		}
+		url = nextPageURL(header)
+	}
+	return refs, nil
+}
+
+// nextPageURL returns the rel="next" target of a Link header, or "".
+func nextPageURL(header http.Header) string {
+	for _, link := range strings.Split(header.Get("Link"), ",") {
+		target, params, ok := strings.Cut(strings.TrimSpace(link), ";")
+		if !ok {
+			continue
+		}
+		for _, param := range strings.Split(params, ";") {
+			if strings.TrimSpace(param) == `rel="next"` {
+				return strings.Trim(strings.TrimSpace(target), "<>")
+			}
+		}
+	}
+	return ""
+}
+
+// GetCommit returns a single commit.
+func (c *GitHubClient) GetCommit(sha string) (*Commit, error) {
+	url := fmt.Sprintf("%s/repos/%s/%s/commits/%s", githubAPIBaseURL, c.repoOwner, c.repo, sha)
+
+	var commit Commit
+	if err := c.doJSON("GET", url, nil, &commit); err != nil {
+		return nil, err
+	}
+	return &commit, nil
+}
+
+// ListPullRequestsForBranch returns pull requests whose head is the given branch.
+func (c *GitHubClient) ListPullRequestsForBranch(branch, state string) ([]PullRequest, error) {
+	var prs []PullRequest
+	for page := 1; ; page++ {
+		url := fmt.Sprintf("%s/repos/%s/%s/pulls?state=%s&head=%s:%s&per_page=%d&page=%d",
+			githubAPIBaseURL, c.repoOwner, c.repo, state, c.repoOwner, branch, perPage, page)
+
+		var batch []PullRequest
+		if err := c.doJSON("GET", url, nil, &batch); err != nil {
+			return nil, err
+		}
+		prs = append(prs, batch...)
+		if len(batch) < perPage {
+			return prs, nil
+		}
+	}
+}
+
+// CreateComment adds a comment to an issue or pull request.
+func (c *GitHubClient) CreateComment(number int, body string) error {
+	url := fmt.Sprintf("%s/repos/%s/%s/issues/%d/comments", githubAPIBaseURL, c.repoOwner, c.repo, number)
+	return c.doJSON("POST", url, createComment{Body: body}, nil)
+}
+
+// ClosePullRequest closes a pull request without merging it.
+func (c *GitHubClient) ClosePullRequest(number int) error {
+	url := fmt.Sprintf("%s/repos/%s/%s/pulls/%d", githubAPIBaseURL, c.repoOwner, c.repo, number)
+	return c.doJSON("PATCH", url, updatePullRequest{State: "closed"}, nil)
+}
+
+// DeleteBranch removes a branch ref from the repository.
+func (c *GitHubClient) DeleteBranch(branch string) error {
+	return c.DeleteRef("heads/" + branch)
+}
+
+// GetRef returns a single ref. The ref is given without the leading "refs/".
+func (c *GitHubClient) GetRef(ref string) (*Ref, error) {
+	url := fmt.Sprintf("%s/repos/%s/%s/git/ref/%s", githubAPIBaseURL, c.repoOwner, c.repo, ref)
+
+	var r Ref
+	if err := c.doJSON("GET", url, nil, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// CreateRef creates a fully qualified ref (e.g. refs/heads/x). GitHub returns
+// 422 when the ref already exists.
+func (c *GitHubClient) CreateRef(ref, sha string) error {
+	url := fmt.Sprintf("%s/repos/%s/%s/git/refs", githubAPIBaseURL, c.repoOwner, c.repo)
+	return c.doJSON("POST", url, createRef{Ref: ref, SHA: sha}, nil)
+}
+
+// UpdateRef points a ref at sha. Without force the update must be a fast-forward.
+func (c *GitHubClient) UpdateRef(ref, sha string, force bool) error {
+	url := fmt.Sprintf("%s/repos/%s/%s/git/refs/%s", githubAPIBaseURL, c.repoOwner, c.repo, ref)
+	return c.doJSON("PATCH", url, updateRef{SHA: sha, Force: force}, nil)
+}
+
+// DeleteRef removes a ref. The ref is given without the leading "refs/".
+func (c *GitHubClient) DeleteRef(ref string) error {
+	url := fmt.Sprintf("%s/repos/%s/%s/git/refs/%s", githubAPIBaseURL, c.repoOwner, c.repo, ref)
+	return c.doJSON("DELETE", url, nil, nil)
+}
+
+// CreateGitCommit writes a commit object without touching any branch.
+func (c *GitHubClient) CreateGitCommit(message, tree string, parents []string) (*GitCommit, error) {
+	url := fmt.Sprintf("%s/repos/%s/%s/git/commits", githubAPIBaseURL, c.repoOwner, c.repo)
+	if parents == nil {
+		parents = []string{}
+	}
+
+	var commit GitCommit
+	if err := c.doJSON("POST", url, createGitCommit{Message: message, Tree: tree, Parents: parents}, &commit); err != nil {
+		return nil, err
+	}
+	return &commit, nil
+}
+
+// GetGitCommit returns a commit object from the git database.
+func (c *GitHubClient) GetGitCommit(sha string) (*GitCommit, error) {
+	url := fmt.Sprintf("%s/repos/%s/%s/git/commits/%s", githubAPIBaseURL, c.repoOwner, c.repo, sha)
+
+	var commit GitCommit
+	if err := c.doJSON("GET", url, nil, &commit); err != nil {
+		return nil, err
+	}
+	return &commit, nil
+}
+
+// CancelWorkflowRun requests cancellation of a workflow run.
+func (c *GitHubClient) CancelWorkflowRun(runID int64) error {
+	url := fmt.Sprintf("%s/repos/%s/%s/actions/runs/%d/cancel", githubAPIBaseURL, c.repoOwner, c.repo, runID)
+	return c.doJSON("POST", url, nil, nil)
+}
+
+// doJSON sends a request with an optional JSON payload and decodes the JSON
+// response into out when out is non-nil.
+func (c *GitHubClient) doJSON(method, url string, payload, out any) error {
+	_, err := c.doJSONHeader(method, url, payload, out)
+	return err
+}
+
+// doJSONHeader is doJSON for callers that need the response headers.
+func (c *GitHubClient) doJSONHeader(method, url string, payload, out any) (http.Header, error) {
+	var body io.Reader
+	if payload != nil {
+		jsonData, err := json.Marshal(payload)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal request: %w", err)
+		}
+		body = bytes.NewBuffer(jsonData)
+	}
+
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	c.decorateHeaders(req)
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return resp.Header, &APIError{StatusCode: resp.StatusCode, Body: string(bodyBytes)}
+	}
+
+	if out == nil {
+		return resp.Header, nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return resp.Header, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return resp.Header, nil
+}
+
+// APIError is returned when GitHub responds with a non-2xx status.
+type APIError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("GitHub API returned status %d: %s", e.StatusCode, e.Body)
+}
+
+// ListCheckRuns returns the check runs for a commit, following pagination.
+func (c *GitHubClient) ListCheckRuns(sha string) ([]CheckRun, error) {
+	var runs []CheckRun
+	for page := 1; ; page++ {
+		url := fmt.Sprintf("%s/repos/%s/%s/commits/%s/check-runs?per_page=%d&page=%d",
+			githubAPIBaseURL, c.repoOwner, c.repo, sha, perPage, page)
+
+		var batch CheckRunList
+		if err := c.doJSON("GET", url, nil, &batch); err != nil {
+			return nil, err
+		}
+		runs = append(runs, batch.CheckRuns...)
+		if len(batch.CheckRuns) < perPage {
+			return runs, nil
+		}
+	}
+}
+
+// ListOpenIssuesWithLabel returns open issues carrying the label, excluding pull requests.
+func (c *GitHubClient) ListOpenIssuesWithLabel(label string) ([]Issue, error) {
+	var issues []Issue
+	for page := 1; ; page++ {
+		url := fmt.Sprintf("%s/repos/%s/%s/issues?state=open&labels=%s&per_page=%d&page=%d",
+			githubAPIBaseURL, c.repoOwner, c.repo, neturl.QueryEscape(label), perPage, page)
+
+		var batch []Issue
+		if err := c.doJSON("GET", url, nil, &batch); err != nil {
+			return nil, err
+		}
+		for _, issue := range batch {
+			if issue.PullRequest == nil {
+				issues = append(issues, issue)
+			}
+		}
+		if len(batch) < perPage {
+			return issues, nil
+		}
+	}
+}
+
+// CreateIssue opens a new issue.
+func (c *GitHubClient) CreateIssue(title, body string, labels []string) (*Issue, error) {
+	url := fmt.Sprintf("%s/repos/%s/%s/issues", githubAPIBaseURL, c.repoOwner, c.repo)
+
+	var issue Issue
+	if err := c.doJSON("POST", url, createIssue{Title: title, Body: body, Labels: labels}, &issue); err != nil {
+		return nil, err
+	}
+	return &issue, nil
+}
+
+// CloseIssue closes an issue as completed.
+func (c *GitHubClient) CloseIssue(number int) error {
+	url := fmt.Sprintf("%s/repos/%s/%s/issues/%d", githubAPIBaseURL, c.repoOwner, c.repo, number)
+	return c.doJSON("PATCH", url, updateIssue{State: "closed", StateReason: "completed"}, nil)
+}
+
+// GetBranch returns a branch and its head commit.
+func (c *GitHubClient) GetBranch(branch string) (*BranchInfo, error) {
+	url := fmt.Sprintf("%s/repos/%s/%s/branches/%s", githubAPIBaseURL, c.repoOwner, c.repo, branch)
+
+	var info BranchInfo
+	if err := c.doJSON("GET", url, nil, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// GetPullRequest returns a single pull request.
+func (c *GitHubClient) GetPullRequest(number int) (*PullRequest, error) {
+	url := fmt.Sprintf("%s/repos/%s/%s/pulls/%d", githubAPIBaseURL, c.repoOwner, c.repo, number)
+
+	var pr PullRequest
+	if err := c.doJSON("GET", url, nil, &pr); err != nil {
+		return nil, err
+	}
+	return &pr, nil
+}
+
+// UpdatePullRequestBranch merges the base branch into the PR head. GitHub
+// performs the update asynchronously.
+func (c *GitHubClient) UpdatePullRequestBranch(number int, expectedHeadSHA string) error {
+	url := fmt.Sprintf("%s/repos/%s/%s/pulls/%d/update-branch", githubAPIBaseURL, c.repoOwner, c.repo, number)
+	return c.doJSON("PUT", url, updatePullRequestBranch{ExpectedHeadSHA: expectedHeadSHA}, nil)
+}
+
+// isAPIStatus reports whether err is an APIError with the given status code.
+func isAPIStatus(err error, statusCode int) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == statusCode
+}
+
+// ListBranches returns every branch in the repository, following pagination.
+func (c *GitHubClient) ListBranches() ([]BranchInfo, error) {
+	var branches []BranchInfo
+	for page := 1; ; page++ {
+		url := fmt.Sprintf("%s/repos/%s/%s/branches?per_page=%d&page=%d",
+			githubAPIBaseURL, c.repoOwner, c.repo, perPage, page)
+
+		var batch []BranchInfo
+		if err := c.doJSON("GET", url, nil, &batch); err != nil {
+			return nil, err
+		}
+		branches = append(branches, batch...)
+		if len(batch) < perPage {
+			return branches, nil
+		}
+	}
+}
+
+// GetRepository returns the repository the client is bound to.
+func (c *GitHubClient) GetRepository() (*Repository, error) {
+	url := fmt.Sprintf("%s/repos/%s/%s", githubAPIBaseURL, c.repoOwner, c.repo)
+
+	var repo Repository
+	if err := c.doJSON("GET", url, nil, &repo); err != nil {
+		return nil, err
+	}
+	return &repo, nil
+}
+
+// ListOpenPullRequests returns the open pull requests targeting base,
+// following pagination.
+func (c *GitHubClient) ListOpenPullRequests(base string) ([]PullRequest, error) {
+	var prs []PullRequest
+	for page := 1; ; page++ {
+		url := fmt.Sprintf("%s/repos/%s/%s/pulls?state=open&base=%s&per_page=%d&page=%d",
+			githubAPIBaseURL, c.repoOwner, c.repo, neturl.QueryEscape(base), perPage, page)
+
+		var batch []PullRequest
+		if err := c.doJSON("GET", url, nil, &batch); err != nil {
+			return nil, err
+		}
+		prs = append(prs, batch...)
+		if len(batch) < perPage {
+			return prs, nil
+		}
+	}
+}
+
+// ListComments returns the comments on an issue or pull request, following
+// pagination.
+func (c *GitHubClient) ListComments(number int) ([]IssueComment, error) {
+	var comments []IssueComment
+	for page := 1; ; page++ {
+		url := fmt.Sprintf("%s/repos/%s/%s/issues/%d/comments?per_page=%d&page=%d",
+			githubAPIBaseURL, c.repoOwner, c.repo, number, perPage, page)
+
+		var batch []IssueComment
+		if err := c.doJSON("GET", url, nil, &batch); err != nil {
+			return nil, err
+		}
+		comments = append(comments, batch...)
+		if len(batch) < perPage {
+			return comments, nil
+		}
+	}
+}
+
+// CompareCommits compares head against base.
+func (c *GitHubClient) CompareCommits(base, head string) (*Comparison, error) {
+	url := fmt.Sprintf("%s/repos/%s/%s/compare/%s...%s", githubAPIBaseURL, c.repoOwner, c.repo, base, head)
+
+	var comparison Comparison
+	if err := c.doJSON("GET", url, nil, &comparison); err != nil {
+		return nil, err
+	}
+	return &comparison, nil
+}
+
+// GetAuthenticatedUser returns the user the token belongs to.
+func (c *GitHubClient) GetAuthenticatedUser() (*User, error) {
+	url := fmt.Sprintf("%s/user", githubAPIBaseURL)
+
+	var user User
+	if err := c.doJSON("GET", url, nil, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// CreateFork forks the repository into organization, or into the token's
+// user when organization is empty. GitHub creates forks asynchronously.
+func (c *GitHubClient) CreateFork(organization, name string) (*Repository, error) {
+	url := fmt.Sprintf("%s/repos/%s/%s/forks", githubAPIBaseURL, c.repoOwner, c.repo)
+
+	var repo Repository
+	if err := c.doJSON("POST", url, createFork{Organization: organization, Name: name, DefaultBranchOnly: true}, &repo); err != nil {
+		return nil, err
+	}
+	return &repo, nil
+}
+
+// MergeUpstream syncs branch of the fork with its upstream repository.
+func (c *GitHubClient) MergeUpstream(branch string) error {
+	url := fmt.Sprintf("%s/repos/%s/%s/merge-upstream", githubAPIBaseURL, c.repoOwner, c.repo)
+	return c.doJSON("POST", url, mergeUpstream{Branch: branch}, nil)
+}
+
+// GetBranchProtection returns the classic protection of branch.
+func (c *GitHubClient) GetBranchProtection(branch string) (*BranchProtection, error) {
+	url := fmt.Sprintf("%s/repos/%s/%s/branches/%s/protection", githubAPIBaseURL, c.repoOwner, c.repo, branch)
+
+	var protection BranchProtection
+	if err := c.doJSON("GET", url, nil, &protection); err != nil {
+		return nil, err
+	}
+	return &protection, nil
+}
+
+// ListBranchRules returns the ruleset rules active on branch, following
+// pagination.
+func (c *GitHubClient) ListBranchRules(branch string) ([]BranchRule, error) {
+	var rules []BranchRule
+	for page := 1; ; page++ {
+		url := fmt.Sprintf("%s/repos/%s/%s/rules/branches/%s?per_page=%d&page=%d",
+			githubAPIBaseURL, c.repoOwner, c.repo, branch, perPage, page)
+
+		var batch []BranchRule
+		if err := c.doJSON("GET", url, nil, &batch); err != nil {
+			return nil, err
+		}
+		rules = append(rules, batch...)
+		if len(batch) < perPage {
+			return rules, nil
+		}
+	}
+}
+
+// GetRuleset returns a ruleset that applies to the repository.
+func (c *GitHubClient) GetRuleset(id int64) (*Ruleset, error) {
+	url := fmt.Sprintf("%s/repos/%s/%s/rulesets/%d?includes_parents=true", githubAPIBaseURL, c.repoOwner, c.repo, id)
+
+	var ruleset Ruleset
+	if err := c.doJSON("GET", url, nil, &ruleset); err != nil {
+		return nil, err
+	}
+	return &ruleset, nil
+}
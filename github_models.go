@@ -1,6 +1,9 @@
 package main
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 // PullRequest represents a GitHub pull request
 type PullRequest struct {
@@ -209,6 +212,7 @@ type Repository struct {
 	Forks               int         `json:"forks"`
 	OpenIssues          int         `json:"open_issues"`
 	Watchers            int         `json:"watchers"`
+	Parent              *Repository `json:"parent"`
 }
 
 // Permission represents repository permissions
@@ -302,3 +306,198 @@ type RepositoryMeta struct {
 	Name  string `json:"name"`
 	Owner User   `json:"owner"`
 }
+
+// Ref represents a git reference.
+type Ref struct {
+	Ref    string    `json:"ref"`
+	NodeID string    `json:"node_id"`
+	URL    string    `json:"url"`
+	Object RefObject `json:"object"`
+}
+
+// RefObject is the object a ref points at.
+type RefObject struct {
+	Type string `json:"type"`
+	SHA  string `json:"sha"`
+	URL  string `json:"url"`
+}
+
+// Commit represents a commit returned by the commits API.
+type Commit struct {
+	SHA     string    `json:"sha"`
+	HTMLURL string    `json:"html_url"`
+	Commit  GitCommit `json:"commit"`
+}
+
+// GitCommit holds the git-level details of a commit.
+type GitCommit struct {
+	SHA       string      `json:"sha"`
+	Message   string      `json:"message"`
+	Author    GitActor    `json:"author"`
+	Committer GitActor    `json:"committer"`
+	Tree      RefObject   `json:"tree"`
+	Parents   []RefObject `json:"parents"`
+}
+
+// GitActor is the author or committer of a commit.
+type GitActor struct {
+	Name  string    `json:"name"`
+	Email string    `json:"email"`
+	Date  time.Time `json:"date"`
+}
+
+type createComment struct {
+	Body string `json:"body"`
+}
+
+type updatePullRequest struct {
+	State string `json:"state,omitempty"`
+}
+
+// CheckRunList is the response from the check runs API.
+type CheckRunList struct {
+	TotalCount int        `json:"total_count"`
+	CheckRuns  []CheckRun `json:"check_runs"`
+}
+
+// CheckRun represents a single check run.
+type CheckRun struct {
+	ID          int            `json:"id"`
+	Name        string         `json:"name"`
+	HeadSHA     string         `json:"head_sha"`
+	Status      string         `json:"status"`
+	Conclusion  string         `json:"conclusion"`
+	HTMLURL     string         `json:"html_url"`
+	DetailsURL  string         `json:"details_url"`
+	StartedAt   *time.Time     `json:"started_at"`
+	CompletedAt *time.Time     `json:"completed_at"`
+	Output      CheckRunOutput `json:"output"`
+}
+
+// CheckRunOutput is the summary attached to a check run.
+type CheckRunOutput struct {
+	Title   string `json:"title"`
+	Summary string `json:"summary"`
+}
+
+// Issue represents a GitHub issue.
+type Issue struct {
+	ID          int        `json:"id"`
+	Number      int        `json:"number"`
+	Title       string     `json:"title"`
+	Body        string     `json:"body"`
+	State       string     `json:"state"`
+	HTMLURL     string     `json:"html_url"`
+	User        User       `json:"user"`
+	Labels      []Label    `json:"labels"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	ClosedAt    *time.Time `json:"closed_at"`
+	PullRequest *struct {
+		URL string `json:"url"`
+	} `json:"pull_request"`
+}
+
+type createIssue struct {
+	Title  string   `json:"title"`
+	Body   string   `json:"body"`
+	Labels []string `json:"labels,omitempty"`
+}
+
+type updateIssue struct {
+	State       string `json:"state,omitempty"`
+	StateReason string `json:"state_reason,omitempty"`
+}
+
+// BranchProtection is the classic protection of a branch. Reading it needs
+// admin access.
+type BranchProtection struct {
+	RequiredStatusChecks       *struct{}         `json:"required_status_checks"`
+	RequiredPullRequestReviews *RequiredReviews  `json:"required_pull_request_reviews"`
+	Restrictions               *struct{}         `json:"restrictions"`
+	EnforceAdmins              ProtectionSetting `json:"enforce_admins"`
+	RequiredLinearHistory      ProtectionSetting `json:"required_linear_history"`
+	RequiredSignatures         ProtectionSetting `json:"required_signatures"`
+}
+
+type RequiredReviews struct {
+	RequiredApprovingReviewCount int `json:"required_approving_review_count"`
+}
+
+type ProtectionSetting struct {
+	Enabled bool `json:"enabled"`
+}
+
+// BranchRule is a ruleset rule that applies to a branch.
+type BranchRule struct {
+	Type       string          `json:"type"`
+	RulesetID  int64           `json:"ruleset_id"`
+	Parameters json.RawMessage `json:"parameters"`
+}
+
+// Ruleset is a repository or organization ruleset. CurrentUserCanBypass is
+// "always", "pull_requests_only" or "never".
+type Ruleset struct {
+	ID                   int64  `json:"id"`
+	Name                 string `json:"name"`
+	CurrentUserCanBypass string `json:"current_user_can_bypass"`
+}
+
+// BranchInfo represents a branch returned by the branches API.
+type BranchInfo struct {
+	Name      string    `json:"name"`
+	Commit    RefObject `json:"commit"`
+	Protected bool      `json:"protected"`
+}
+
+type updatePullRequestBranch struct {
+	ExpectedHeadSHA string `json:"expected_head_sha,omitempty"`
+}
+
+type createRef struct {
+	Ref string `json:"ref"`
+	SHA string `json:"sha"`
+}
+
+type updateRef struct {
+	SHA   string `json:"sha"`
+	Force bool   `json:"force"`
+}
+
+type createGitCommit struct {
+	Message string   `json:"message"`
+	Tree    string   `json:"tree"`
+	Parents []string `json:"parents"`
+}
+
+type createFork struct {
+	Organization      string `json:"organization,omitempty"`
+	Name              string `json:"name,omitempty"`
+	DefaultBranchOnly bool   `json:"default_branch_only"`
+}
+
+type mergeUpstream struct {
+	Branch string `json:"branch"`
+}
+
+// IssueComment is a comment on an issue or pull request.
+type IssueComment struct {
+	ID   int64  `json:"id"`
+	Body string `json:"body"`
+	User User   `json:"user"`
+}
+
+// Comparison is the result of comparing two commits.
+type Comparison struct {
+	Status   string `json:"status"`
+	AheadBy  int    `json:"ahead_by"`
+	BehindBy int    `json:"behind_by"`
+}
+
+// EventPayload holds the fields used from the workflow event at GITHUB_EVENT_PATH.
+type EventPayload struct {
+	Before      string       `json:"before"`
+	After       string       `json:"after"`
+	Ref         string       `json:"ref"`
+	PullRequest *PullRequest `json:"pull_request"`
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// testClient returns a client whose requests, whatever their URL, are
+// served by handler.
+func testClient(t *testing.T, handler http.HandlerFunc) *GitHubClient {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	target, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := NewGitHubClient("token", "owner", "repo")
+	client.client.Transport = rewriteTransport{target: target}
+	return client
+}
+
+type rewriteTransport struct {
+	target *url.URL
+}
+
+func (t rewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme = t.target.Scheme
+	req.URL.Host = t.target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestNextPageURL(t *testing.T) {
+	tests := []struct {
+		name, link, want string
+	}{
+		{name: "none", link: "", want: ""},
+		{
+			name: "next and last",
+			link: `<https://api.github.com/x?page=2>; rel="next", <https://api.github.com/x?page=5>; rel="last"`,
+			want: "https://api.github.com/x?page=2",
+		},
+		{name: "last page", link: `<https://api.github.com/x?page=1>; rel="first", <https://api.github.com/x?page=4>; rel="prev"`, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.link != "" {
+				header.Set("Link", tt.link)
+			}
+			if got := nextPageURL(header); got != tt.want {
+				t.Errorf("nextPageURL(%q) = %q, want %q", tt.link, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestListMatchingRefs(t *testing.T) {
+	refs := func(from, to int) []Ref {
+		var out []Ref
+		for i := from; i < to; i++ {
+			out = append(out, Ref{Ref: fmt.Sprintf("refs/heads/auto-merge-%d", i)})
+		}
+		return out
+	}
+
+	t.Run("follows Link", func(t *testing.T) {
+		client := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("page") == "" {
+				w.Header().Set("Link", fmt.Sprintf(`<https://api.github.com%s?page=2>; rel="next"`, r.URL.Path))
+				json.NewEncoder(w).Encode(refs(0, perPage))
+				return
+			}
+			json.NewEncoder(w).Encode(refs(perPage, perPage+3))
+		})
+		got, err := client.ListMatchingRefs("heads/auto-merge-")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != perPage+3 {
+			t.Errorf("got %d refs, want %d", len(got), perPage+3)
+		}
+	})
+
+	t.Run("ignored paging", func(t *testing.T) {
+		requests := 0
+		client := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			if requests > 5 {
+				t.Error("ListMatchingRefs kept paging")
+				w.Write([]byte("[]"))
+				return
+			}
+			w.Header().Set("Link", fmt.Sprintf(`<https://api.github.com%s?page=%d>; rel="next"`, r.URL.Path, requests+1))
+			json.NewEncoder(w).Encode(refs(0, 2*perPage))
+		})
+		got, err := client.ListMatchingRefs("heads/auto-merge-")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 2*perPage {
+			t.Errorf("got %d refs, want %d", len(got), 2*perPage)
+		}
+	})
+}
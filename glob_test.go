@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"*.go", "main.go", true},
+		{"*.go", "cmd/main.go", false},
+		{"docs/*.md", "docs/a.md", true},
+		{"docs/*.md", "docs/a/b.md", false},
+		{"**/*.md", "README.md", true},
+		{"**/*.md", "docs/a/b.md", true},
+		{"docs/**", "docs/a/b.md", true},
+		{"docs/**", "docs", true},
+		{"docs/**/b.md", "docs/b.md", true},
+		{"docs/**/b.md", "docs/a/c/b.md", true},
+		{"docs/**/b.md", "docs/a/c.md", false},
+		{"file?.txt", "file1.txt", true},
+		{"file[0-9].txt", "filex.txt", false},
+		{"[", "[", false},
+	}
+	for _, tt := range tests {
+		if got := matchGlob(tt.pattern, tt.name); got != tt.want {
+			t.Errorf("matchGlob(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
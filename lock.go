@@ -0,0 +1,224 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	lockRefPrefix    = "auto-merge/locks/"
+	lockPollInterval = 15 * time.Second
+	lockRunIDField   = "Run-Id: "
+)
+
+// errLockSuperseded is returned in cancel-older mode when a newer run already
+// holds the lock, meaning this run is the one that should stop.
+var errLockSuperseded = errors.New("a newer run holds the lock")
+
+// heldLocks tracks the locks not yet released, so an interrupted process can
+// release all of them before exiting.
+var (
+	heldLocksMu sync.Mutex
+	heldLocks   = map[*Lock]bool{}
+)
+
+// Lock is a per-base-branch lock held by pointing refs/auto-merge/locks/<base>
+// at a commit whose message names the owning run. Takeovers create a child of
+// the current lock commit and update the ref without force, so the update only
+// succeeds if nobody else changed the lock in the meantime.
+type Lock struct {
+	client *GitHubClient
+	ref    string
+	sha    string
+	once   sync.Once
+	// Waited is true when another run held the lock when this run started.
+	Waited bool
+}
+
+type lockHolder struct {
+	SHA        string
+	RunID      int64
+	AcquiredAt time.Time
+}
+
+// AcquireLock takes the lock for cfg.BaseBranch according to cfg.LockMode.
+func AcquireLock(cfg config, client *GitHubClient, baseSHA string) (*Lock, error) {
+	ref := lockRefPrefix + cfg.BaseBranch
+	runID := currentRunID()
+
+	commit, err := client.GetCommit(baseSHA)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", baseSHA, err)
+	}
+	tree := commit.Commit.Tree.SHA
+	message := fmt.Sprintf("auto-merge lock for %s\n\n%s%d\n", cfg.BaseBranch, lockRunIDField, runID)
+
+	start := time.Now()
+	waited := false
+	for {
+		holder, err := readLock(client, ref)
+		if err != nil {
+			return nil, err
+		}
+
+		if holder == nil {
+			lockCommit, err := client.CreateGitCommit(message, tree, nil)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create lock commit: %w", err)
+			}
+			err = client.CreateRef("refs/"+ref, lockCommit.SHA)
+			if err == nil {
+				return newLock(client, ref, lockCommit.SHA, waited), nil
+			}
+			if !isAPIStatus(err, http.StatusUnprocessableEntity) {
+				return nil, fmt.Errorf("failed to create lock ref: %w", err)
+			}
+			continue
+		}
+
+		takeover := false
+		switch {
+		case runID != 0 && holder.RunID == runID:
+			log.Printf("Lock on %s is held by an earlier attempt of this run; taking it over.\n", cfg.BaseBranch)
+			takeover = true
+		case time.Since(holder.AcquiredAt) > cfg.LockStaleAfter:
+			log.Printf("Lock on %s held by run %d since %s is stale; taking it over.\n",
+				cfg.BaseBranch, holder.RunID, holder.AcquiredAt.Format(time.RFC3339))
+			takeover = true
+		case cfg.LockMode == "cancel-older" && runID != 0 && holder.RunID != 0:
+			if holder.RunID > runID {
+				return nil, errLockSuperseded
+			}
+			log.Printf("Cancelling older run %d holding the lock on %s.\n", holder.RunID, cfg.BaseBranch)
+			if err := client.CancelWorkflowRun(holder.RunID); err != nil {
+				log.Printf("Failed to cancel run %d: %v\n", holder.RunID, err)
+			}
+			takeover = true
+		}
+
+		if takeover {
+			lockCommit, err := client.CreateGitCommit(message, tree, []string{holder.SHA})
+			if err != nil {
+				return nil, fmt.Errorf("failed to create lock commit: %w", err)
+			}
+			err = client.UpdateRef(ref, lockCommit.SHA, false)
+			if err == nil {
+				return newLock(client, ref, lockCommit.SHA, waited), nil
+			}
+			if !isAPIStatus(err, http.StatusUnprocessableEntity) {
+				return nil, fmt.Errorf("failed to take over lock ref: %w", err)
+			}
+			continue
+		}
+
+		if time.Since(start) > cfg.LockWaitTimeout {
+			return nil, fmt.Errorf("timed out after %s waiting for run %d to release the lock on %s",
+				cfg.LockWaitTimeout, holder.RunID, cfg.BaseBranch)
+		}
+		waited = true
+		log.Printf("Lock on %s is held by run %d; checking again in %s...\n", cfg.BaseBranch, holder.RunID, lockPollInterval)
+		time.Sleep(lockPollInterval)
+	}
+}
+
+// Release deletes the lock ref if this run still owns it. It is safe to call
+// more than once, including concurrently from ReleaseHeldLocks.
+func (l *Lock) Release() {
+	l.once.Do(func() {
+		heldLocksMu.Lock()
+		delete(heldLocks, l)
+		heldLocksMu.Unlock()
+
+		current, err := l.client.GetRef(l.ref)
+		if err != nil {
+			if !isAPIStatus(err, http.StatusNotFound) {
+				log.Printf("Failed to read lock %s: %v\n", l.ref, err)
+			}
+			return
+		}
+		if current.Object.SHA != l.sha {
+			log.Printf("Lock %s was taken over by another run; leaving it.\n", l.ref)
+			return
+		}
+		if err := l.client.DeleteRef(l.ref); err != nil {
+			log.Printf("Failed to release lock %s: %v\n", l.ref, err)
+			return
+		}
+		log.Printf("Released lock %s.\n", l.ref)
+	})
+}
+
+func newLock(client *GitHubClient, ref, sha string, waited bool) *Lock {
+	l := &Lock{
+		client: client,
+		ref:    ref,
+		sha:    sha,
+		Waited: waited,
+	}
+	log.Printf("Acquired lock %s.\n", ref)
+
+	heldLocksMu.Lock()
+	heldLocks[l] = true
+	heldLocksMu.Unlock()
+	return l
+}
+
+// ReleaseHeldLocks releases every lock that is still held, in parallel.
+func ReleaseHeldLocks() {
+	heldLocksMu.Lock()
+	locks := make([]*Lock, 0, len(heldLocks))
+	for l := range heldLocks {
+		locks = append(locks, l)
+	}
+	heldLocksMu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, l := range locks {
+		wg.Add(1)
+		go func(l *Lock) {
+			defer wg.Done()
+			l.Release()
+		}(l)
+	}
+	wg.Wait()
+}
+
+// readLock returns the current lock holder, or nil when the lock is free.
+func readLock(client *GitHubClient, ref string) (*lockHolder, error) {
+	current, err := client.GetRef(ref)
+	if err != nil {
+		if isAPIStatus(err, http.StatusNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read lock: %w", err)
+	}
+
+	commit, err := client.GetGitCommit(current.Object.SHA)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lock commit: %w", err)
+	}
+
+	holder := &lockHolder{SHA: commit.SHA, AcquiredAt: commit.Committer.Date}
+	for _, line := range strings.Split(commit.Message, "\n") {
+		if strings.HasPrefix(line, lockRunIDField) {
+			holder.RunID, _ = strconv.ParseInt(strings.TrimPrefix(line, lockRunIDField), 10, 64)
+		}
+	}
+	return holder, nil
+}
+
+// currentRunID returns the workflow run ID, or 0 outside of Actions.
+func currentRunID() int64 {
+	id, err := strconv.ParseInt(os.Getenv("GITHUB_RUN_ID"), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return id
+}
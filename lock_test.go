@@ -0,0 +1,35 @@
+package main
+
+import (
+	"net/http"
+	"sync/atomic"
+	"testing"
+)
+
+func TestReleaseHeldLocks(t *testing.T) {
+	var deleted atomic.Int32
+	client := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			w.Write([]byte(`{"ref": "refs/auto-merge/locks/main", "object": {"sha": "lock-sha"}}`))
+		case http.MethodDelete:
+			deleted.Add(1)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+
+	first := newLock(client, lockRefPrefix+"main", "lock-sha", false)
+	newLock(client, lockRefPrefix+"main", "lock-sha", false)
+	first.Release()
+	ReleaseHeldLocks()
+	first.Release()
+
+	if got := deleted.Load(); got != 2 {
+		t.Errorf("deleted %d lock refs, want 2", got)
+	}
+	heldLocksMu.Lock()
+	defer heldLocksMu.Unlock()
+	if len(heldLocks) != 0 {
+		t.Errorf("%d locks still held", len(heldLocks))
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"time"
+)
+
+// jsonLogs is set when log_format is json. Structured events are only
+// emitted then, so the text output stays as it was.
+var jsonLogs bool
+
+// setupLogging switches to one JSON object per line when format is "json".
+// slog.SetDefault also routes the log package through the JSON handler, so
+// plain log.Printf lines become {"msg": ...} events. Text keeps the log
+// package's default output.
+func setupLogging(format string) {
+	if format != "json" {
+		return
+	}
+	jsonLogs = true
+	handler := slog.NewJSONHandler(newRedactingWriter(os.Stderr), nil)
+	slog.SetDefault(slog.New(handler))
+}
+
+// runStage runs fn inside a log group and, in JSON mode, emits an event with
+// the stage name, its duration, any extra attributes and the error if it
+// failed.
+func runStage(stage, title string, fn func() error, attrs ...any) error {
+	start := time.Now()
+	err := group(title, fn)
+	if !jsonLogs {
+		return err
+	}
+
+	args := append([]any{"stage", stage, "duration_ms", time.Since(start).Milliseconds()}, attrs...)
+	if err != nil {
+		slog.Error("Stage failed", append(args, "error", err.Error())...)
+	} else {
+		slog.Info("Stage finished", args...)
+	}
+	return err
+}
+
+// logEvent emits a structured event in JSON mode. Text mode has no
+// equivalent line.
+func logEvent(msg string, attrs ...any) {
+	if jsonLogs {
+		slog.Info(msg, attrs...)
+	}
+}
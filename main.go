@@ -1,84 +1,516 @@
 package main
 
 import (
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"log"
+	"log/slog"
 	"os"
 	"os/exec"
+	"os/signal"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 )
 
 type config struct {
-	AccessToken    string
-	CommitPrefix   string
-	Commands       []string
-	RepoOwner      string
-	RepoName       string
-	BaseBranch     string
-	IgnorePrefixes []string
-	RunOnPrefixes  []string
-	RunOnContains  []string
-	WaitSeconds    int
-	CIWaitTimeout  time.Duration
-	CIWaitInterval time.Duration
-	PushRemote     string
+	AccessToken          string
+	CommitPrefix         string
+	Commands             []string
+	RepoOwner            string
+	RepoName             string
+	BaseBranch           string
+	BaseBranches         []string
+	IgnorePrefixes       []string
+	RunOnPrefixes        []string
+	RunOnContains        []string
+	WaitSeconds          int
+	CIWaitTimeout        time.Duration
+	CIWaitInterval       time.Duration
+	PushRemote           string
+	CloseOnCIFailure     bool
+	TrackFailures        bool
+	FailureLabel         string
+	BaseMovedStrategy    string
+	BaseMovedMaxAttempts int
+	LockMode             string
+	LockStaleAfter       time.Duration
+	LockWaitTimeout      time.Duration
+	WorkDir              string
+	Repositories         []string
+	MaxParallel          int
+	PartitionBy          string
+	PartitionPaths       []string
+	Partition            string
+	StagePaths           []string
+	MaskEnv              []string
+	LogFormat            string
+	MaxChangedFiles      int
+	MaxAddedLines        int
+	MaxRemovedLines      int
+	ForbiddenPaths       []string
+	AllowedPaths         []string
+	SafeguardAction      string
+	IncludePaths         []string
+	ExcludePaths         []string
+	Strict               bool
+	AllowedUntracked     []string
+	CommandEnv           []string
+	ExposeToken          bool
+	WorkBranch           string
+	BaseSHA              string
+	TriggerSHA           string
+	BeforeSHA            string
+	ChangedFilesPath     string
+	Mode                 string
+	MergeSource          string
+	MergeTargets         []string
+	MergePush            string
+	MergeConflicts       string
+	ConflictStrategies   []ConflictStrategy
+	UpdatePRsMethod      string
+	UpdatePRsLabels      []string
+	UpdatePRsAuthors     []string
+	UpdatePRsDrafts      string
+	CommitToPR           bool
+	DirectPush           bool
+	PushOwner            string
+	PushRepo             string
+	SSHKey               string
+	SSHKnownHosts        string
+	SSHCommand           string
 }
 
 func main() {
+	log.SetOutput(newRedactingWriter(os.Stderr))
+
+	if len(os.Args) > 1 && os.Args[1] == "cleanup" {
+		if err := RunCleanup(os.Args[2:]); err != nil {
+			fail(err)
+		}
+		return
+	}
+
 	cfg, err := loadConfig()
 	if err != nil {
 		fail(err)
 	}
+	registerSecrets(cfg)
+	setupLogging(cfg.LogFormat)
 
-	shouldRun, err := ConfirmShouldRun(cfg)
+	cfg, removeSSHFiles, err := setupSSH(cfg)
 	if err != nil {
 		fail(err)
 	}
 
-	if !shouldRun {
-		log.Println("Last commit uses an ignore prefix. Exiting without action.")
-		return
+	// An interrupted run releases every lock it holds before exiting.
+	interrupted := make(chan os.Signal, 1)
+	signal.Notify(interrupted, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-interrupted
+		log.Printf("Received %s; releasing locks.\n", sig)
+		ReleaseHeldLocks()
+		removeSSHFiles()
+		os.Exit(1)
+	}()
+
+	var results []TargetResult
+	if len(cfg.Repositories) > 0 {
+		results = RunRepositories(cfg)
+	} else {
+		client := NewGitHubClient(cfg.AccessToken, cfg.RepoOwner, cfg.RepoName)
+		results = runRepository(cfg, client)
 	}
+	removeSSHFiles()
 
-	if err := RunCommands(cfg.Commands); err != nil {
+	if err := ReportResults(results); err != nil {
 		fail(err)
 	}
+}
 
-	changed, err := hasChanges()
+// runRepository runs the pipeline for one repository, turning a failure
+// before any target starts into a failed result.
+func runRepository(cfg config, client *GitHubClient) []TargetResult {
+	results, err := run(cfg, client)
 	if err != nil {
-		fail(err)
+		annotateError(err)
+		if cfg.TrackFailures {
+			ReportFailureIssue(cfg, client, err)
+		}
+		results = append(results, TargetResult{
+			Repository: cfg.RepoOwner + "/" + cfg.RepoName,
+			Branch:     cfg.BaseBranch,
+			Outcome:    OutcomeFailed,
+			Err:        err,
+		})
 	}
+	return results
+}
 
-	if !changed {
-		log.Println("No changes detected after running commands. Nothing to commit.")
-		return
+// run checks whether the latest commit should be processed and then runs
+// the pipeline once per resolved base branch.
+func run(cfg config, client *GitHubClient) ([]TargetResult, error) {
+	shouldRun, err := ConfirmShouldRun(cfg)
+	if err != nil {
+		return nil, &StageError{Stage: "confirm", Err: err}
 	}
 
-	client := NewGitHubClient(cfg.AccessToken, cfg.RepoOwner, cfg.RepoName)
+	if !shouldRun {
+		notice("Last commit uses an ignore prefix. Exiting without action.")
+		return nil, nil
+	}
 
-	pr, headSHA, err := CommitAndOpenPR(cfg, client)
+	err = runStage("preflight", "Check permissions", func() error {
+		return Preflight(cfg, client)
+	})
 	if err != nil {
-		fail(err)
+		return nil, &StageError{Stage: "preflight", Err: err}
+	}
+
+	cfg, cleanup, err := withPushContext(cfg)
+	if err != nil {
+		return nil, &StageError{Stage: "context", Err: err}
 	}
+	defer cleanup()
 
-	Wait(cfg)
+	if cfg.CommitToPR {
+		event, err := readEventPayload()
+		if err != nil {
+			return nil, &StageError{Stage: "context", Err: err}
+		}
+		if event.PullRequest != nil {
+			results := CommitToPullRequest(cfg, client, event.PullRequest)
+			for _, result := range results {
+				if result.Err != nil {
+					annotateError(result.Err)
+				}
+			}
+			return results, nil
+		}
+	}
 
-	if err := WaitForCI(cfg, client, headSHA); err != nil {
-		fail(err)
+	var targets []string
+	if cfg.Mode == "merge" {
+		targets, err = ResolveMergeTargets(cfg, client)
+	} else {
+		targets, err = ResolveBaseBranches(cfg, client)
+	}
+	if err != nil {
+		return nil, &StageError{Stage: "targets", Err: err}
 	}
 
-	if err := Merge(cfg, client, pr); err != nil {
-		fail(err)
+	if pushesToFork(cfg) && cfg.Mode != "update-prs" {
+		err := runStage("fork", "Prepare fork "+cfg.PushOwner+"/"+cfg.PushRepo, func() error {
+			return EnsureFork(cfg, client, targets)
+		})
+		if err != nil {
+			return nil, &StageError{Stage: "fork", Err: err}
+		}
+	}
+
+	var results []TargetResult
+	for i, branch := range targets {
+		targetCfg := cfg
+		targetCfg.BaseBranch = branch
+
+		var targetResults []TargetResult
+		switch cfg.Mode {
+		case "merge":
+			targetCfg.MergeSource = cfg.BaseBranch
+			targetResults = runMergeTarget(targetCfg, client)
+		case "update-prs":
+			targetResults = UpdatePullRequests(targetCfg, client)
+		default:
+			// The checkout is already at cfg.BaseBranch; any other target, or
+			// any target after the first, starts from a fresh checkout.
+			checkout := i > 0 || branch != cfg.BaseBranch
+			targetResults = runTarget(targetCfg, client, checkout)
+		}
+		for _, result := range targetResults {
+			results = append(results, result)
+
+			if result.Err != nil {
+				annotateError(result.Err)
+			}
+			if targetCfg.TrackFailures {
+				trackCfg := targetCfg
+				trackCfg.Partition = result.Partition
+				if result.Err != nil {
+					ReportFailureIssue(trackCfg, client, result.Err)
+				} else if result.Outcome == OutcomeMerged {
+					CloseFailureIssue(trackCfg, client)
+				}
+			}
+		}
+	}
+
+	return results, nil
+}
+
+// runTarget executes the pipeline against cfg.BaseBranch, producing one
+// result per PR (or a single result when nothing was opened). Errors are
+// wrapped in a StageError naming the step that failed.
+func runTarget(cfg config, client *GitHubClient, checkout bool) []TargetResult {
+	cfg.WorkBranch = fmt.Sprintf("auto-merge-%d-%s", time.Now().Unix(), sanitizeRefComponent(cfg.BaseBranch))
+	result := TargetResult{Repository: cfg.RepoOwner + "/" + cfg.RepoName, Branch: cfg.BaseBranch}
+	failed := func(stage string, err error) []TargetResult {
+		result.Outcome = OutcomeFailed
+		result.Err = &StageError{Stage: stage, Err: err}
+		return []TargetResult{result}
+	}
+
+	var baseSHA string
+	var err error
+	if checkout {
+		err = runStage("checkout", "Check out "+cfg.BaseBranch, func() error {
+			var err error
+			baseSHA, err = checkoutLatestBase(cfg)
+			return err
+		}, "branch", cfg.BaseBranch)
+	} else {
+		baseSHA, err = gitHeadSHA(cfg.WorkDir)
+	}
+	if err != nil {
+		return failed("checkout", err)
+	}
+
+	if cfg.LockMode != "none" {
+		var lock *Lock
+		err := runStage("lock", "Acquire lock on "+cfg.BaseBranch, func() error {
+			var err error
+			lock, err = AcquireLock(cfg, client, baseSHA)
+			return err
+		}, "branch", cfg.BaseBranch, "sha", baseSHA)
+		if errors.Is(err, errLockSuperseded) {
+			notice(fmt.Sprintf("A newer run holds the lock on %s. Exiting without action.", cfg.BaseBranch))
+			result.Outcome = OutcomeSkipped
+			return []TargetResult{result}
+		}
+		if err != nil {
+			return failed("lock", err)
+		}
+		defer lock.Release()
+
+		if lock.Waited {
+			baseSHA, err = checkoutLatestBase(cfg)
+			if err != nil {
+				return failed("lock", err)
+			}
+		}
+	}
+
+	cfg.BaseSHA = baseSHA
+	commandCfg := cfg
+	if cfg.DirectPush || cfg.PartitionBy != "" {
+		// The branch isn't known yet: a direct push may fall back to a PR,
+		// and each partition gets its own branch.
+		commandCfg.WorkBranch = ""
+	}
+	if err := RunCommands(commandCfg); err != nil {
+		return failed("commands", err)
+	}
+
+	if cfg.Strict {
+		if err := CheckStrict(cfg); err != nil {
+			return failed("strict", err)
+		}
+	}
+
+	changed, err := hasChanges(cfg.WorkDir, cfg.StagePaths...)
+	if err != nil {
+		return failed("changes", err)
+	}
+
+	if !changed {
+		notice(fmt.Sprintf("No changes detected on %s after running commands. Nothing to commit.", cfg.BaseBranch))
+		result.Outcome = OutcomeNoChanges
+		return []TargetResult{result}
+	}
+
+	safeguardErr, err := CheckSafeguards(cfg)
+	if err != nil {
+		return failed("safeguards", err)
+	}
+	if safeguardErr != nil {
+		if cfg.SafeguardAction == "fail" {
+			return failed("safeguards", safeguardErr)
+		}
+		log.Println(safeguardErr)
+		notice("Changes violate safeguards; opening PRs without merging.")
+	}
+
+	if cfg.DirectPush && safeguardErr == nil {
+		var outcome string
+		outcome, baseSHA, err = PushDirect(cfg, client, baseSHA)
+		cfg.BaseSHA = baseSHA
+		if errors.Is(err, errDirectFallback) {
+			// The fallback may carry changes made on a newer base.
+			safeguardErr, err = CheckSafeguards(cfg)
+			if err != nil {
+				return failed("safeguards", err)
+			}
+			if safeguardErr != nil {
+				log.Println(safeguardErr)
+				notice("Changes violate safeguards; opening PRs without merging.")
+			}
+		} else if err != nil {
+			return failed("push", err)
+		} else {
+			result.Outcome = outcome
+			return []TargetResult{result}
+		}
+	}
+
+	partitions := []Partition{{}}
+	if cfg.PartitionBy != "" {
+		partitions, err = PartitionChanges(cfg)
+		if err != nil {
+			return failed("partition", err)
+		}
+	}
+
+	// Open every PR first so the partitions' CI runs overlap, then gate and
+	// merge each one independently.
+	type openPR struct {
+		cfg     config
+		result  TargetResult
+		pr      *PullRequest
+		headSHA string
+	}
+	var opened []openPR
+	var results []TargetResult
+	for _, partition := range partitions {
+		partCfg := cfg
+		partCfg.Partition = partition.Name
+		partCfg.StagePaths = partition.Pathspecs
+		partResult := result
+		partResult.Partition = partition.Name
+
+		if partition.Name != "" {
+			if err := runGit(cfg.WorkDir, "checkout", "--detach", baseSHA); err != nil {
+				partResult.Outcome = OutcomeFailed
+				partResult.Err = &StageError{Stage: "commit", Err: fmt.Errorf("failed to return to %s: %w", baseSHA, err)}
+				results = append(results, partResult)
+				continue
+			}
+		}
+
+		var pr *PullRequest
+		var headSHA string
+		err := runStage("commit", "Open pull request "+partResult.Label(), func() error {
+			var err error
+			pr, headSHA, err = CommitAndOpenPR(partCfg, client)
+			return err
+		}, "branch", cfg.BaseBranch, "partition", partition.Name)
+		if err != nil {
+			partResult.Outcome = OutcomeFailed
+			partResult.Err = &StageError{Stage: "commit", Err: err}
+			results = append(results, partResult)
+			continue
+		}
+		partResult.PR = pr
+		opened = append(opened, openPR{cfg: partCfg, result: partResult, pr: pr, headSHA: headSHA})
+	}
+
+	for _, o := range opened {
+		if safeguardErr != nil {
+			if err := client.CreateComment(o.pr.Number, redact(safeguardErr.Markdown())); err != nil {
+				log.Printf("Failed to comment on PR #%d: %v\n", o.pr.Number, err)
+			}
+			o.result.Outcome = OutcomeOpened
+			results = append(results, o.result)
+			continue
+		}
+		if o.cfg.Partition != "" {
+			log.Printf("Processing partition %s (PR #%d).\n", o.cfg.Partition, o.pr.Number)
+		}
+		o.result.Outcome, o.result.Err = deliverPullRequest(o.cfg, client, o.pr, o.headSHA, baseSHA)
+		results = append(results, o.result)
+	}
+	return results
+}
+
+// deliverPullRequest waits for CI on the PR, refreshes it if the base branch
+// moved, and merges it.
+func deliverPullRequest(cfg config, client *GitHubClient, pr *PullRequest, headSHA, baseSHA string) (string, error) {
+	if pushesToFork(cfg) {
+		// A token that can only push to a fork cannot merge here either.
+		notice(fmt.Sprintf("Opened PR #%d from %s/%s; a maintainer needs to merge it.", pr.Number, cfg.PushOwner, cfg.PushRepo))
+		return OutcomeOpened, nil
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := runStage("ci", fmt.Sprintf("Wait for CI on PR #%d", pr.Number), func() error {
+			Wait(cfg)
+			return WaitForCI(cfg, client, headSHA)
+		}, "pr", pr.Number, "sha", headSHA)
+		if err != nil {
+			ReportCIFailure(cfg, client, pr, err)
+			return OutcomeFailed, &StageError{Stage: "ci", Err: err}
+		}
+
+		if cfg.BaseMovedStrategy == "ignore" {
+			break
+		}
+
+		currentBase, err := baseHeadSHA(cfg, client)
+		if err != nil {
+			return OutcomeFailed, &StageError{Stage: "sync", Err: err}
+		}
+		if currentBase == baseSHA {
+			break
+		}
+		if attempt >= cfg.BaseMovedMaxAttempts {
+			return OutcomeFailed, &StageError{Stage: "sync", Err: fmt.Errorf("%s kept moving after %d attempts", cfg.BaseBranch, attempt)}
+		}
+
+		log.Printf("%s moved from %s to %s during CI; refreshing PR #%d (attempt %d of %d).\n",
+			cfg.BaseBranch, baseSHA, currentBase, pr.Number, attempt, cfg.BaseMovedMaxAttempts)
+		headSHA, err = RefreshPullRequest(cfg, client, pr, headSHA, currentBase)
+		if errors.Is(err, errMergeHeld) {
+			notice(fmt.Sprintf("Changes on the new %s violate safeguards; left PR #%d open without merging.", cfg.BaseBranch, pr.Number))
+			return OutcomeOpened, nil
+		}
+		if err != nil {
+			return OutcomeFailed, &StageError{Stage: "sync", Err: err}
+		}
+		if headSHA == "" {
+			notice(fmt.Sprintf("No changes remain on the new %s. Closed PR #%d without merging.", cfg.BaseBranch, pr.Number))
+			return OutcomeClosed, nil
+		}
+		baseSHA = currentBase
 	}
 
-	log.Println("Completed merge from main.")
+	err := runStage("merge", fmt.Sprintf("Merge PR #%d", pr.Number), func() error {
+		return Merge(cfg, client, pr, headSHA)
+	}, "pr", pr.Number, "sha", headSHA)
+	if err != nil {
+		return OutcomeFailed, &StageError{Stage: "merge", Err: err}
+	}
+
+	log.Printf("Completed merge of PR #%d into %s.\n", pr.Number, cfg.BaseBranch)
+	return OutcomeMerged, nil
+}
+
+// StageError records which pipeline stage produced an error.
+type StageError struct {
+	Stage string
+	Err   error
+}
+
+func (e *StageError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Stage, e.Err)
+}
+
+func (e *StageError) Unwrap() error {
+	return e.Err
 }
 
 // ConfirmShouldRun returns false when the last commit is already an auto-merge.
 func ConfirmShouldRun(cfg config) (bool, error) {
-	msg, err := latestCommitMessage()
+	msg, err := latestCommitMessage(cfg.WorkDir)
 	if err != nil {
 		return false, err
 	}
@@ -118,18 +550,29 @@ func ConfirmShouldRun(cfg config) (bool, error) {
 	return prefixMatch && containsMatch, nil
 }
 
-// RunCommands executes the provided commands sequentially.
-func RunCommands(commands []string) error {
-	for _, cmd := range commands {
+// RunCommands executes the configured commands sequentially in cfg.WorkDir
+// with a scrubbed environment (see commandEnv).
+func RunCommands(cfg config) error {
+	for _, cmd := range cfg.Commands {
 		command := strings.TrimSpace(cmd)
 		if command == "" {
 			continue
 		}
-		log.Printf("Running command: %s\n", command)
-		c := exec.Command("bash", "-lc", command)
-		c.Stdout = os.Stdout
-		c.Stderr = os.Stderr
-		if err := c.Run(); err != nil {
+		err := runStage("commands", "Run "+command, func() error {
+			log.Printf("Running command: %s\n", command)
+			c := exec.Command("bash", "-lc", command)
+			c.Dir = cfg.WorkDir
+			c.Env = append(commandEnv(cfg), contextEnv(cfg)...)
+			stdout := newRedactingWriter(os.Stdout)
+			stderr := newRedactingWriter(os.Stderr)
+			c.Stdout = stdout
+			c.Stderr = stderr
+			err := c.Run()
+			stdout.Flush()
+			stderr.Flush()
+			return err
+		}, "command", command)
+		if err != nil {
 			return fmt.Errorf("command failed (%s): %w", command, err)
 		}
 	}
@@ -138,47 +581,105 @@ func RunCommands(commands []string) error {
 
 // CommitAndOpenPR commits changes, pushes a branch, and opens a PR.
 func CommitAndOpenPR(cfg config, client *GitHubClient) (*PullRequest, string, error) {
-	branchName := fmt.Sprintf("auto-merge-%d", time.Now().Unix())
-	if err := runGit("checkout", "-b", branchName); err != nil {
-		return nil, "", fmt.Errorf("failed to create branch: %w", err)
-	}
-
-	if err := ensureGitUser(); err != nil {
-		return nil, "", fmt.Errorf("failed to configure git user: %w", err)
+	branchName := cfg.WorkBranch
+	if cfg.Partition != "" {
+		branchName = fmt.Sprintf("%s-%s", branchName, sanitizeRefComponent(cfg.Partition))
 	}
-
-	if err := runGit("add", "--all"); err != nil {
-		return nil, "", fmt.Errorf("failed to add changes: %w", err)
+	if err := runGit(cfg.WorkDir, "checkout", "-b", branchName); err != nil {
+		return nil, "", fmt.Errorf("failed to create branch: %w", err)
 	}
 
-	commitMessage := fmt.Sprintf("%s Merge from %s", cfg.CommitPrefix, cfg.BaseBranch)
-	if err := runGit("commit", "-m", commitMessage); err != nil {
-		return nil, "", fmt.Errorf("failed to commit changes: %w", err)
+	commitMessage, err := commitChanges(cfg)
+	if err != nil {
+		return nil, "", err
 	}
 
-	pushURL := cfg.PushRemote
-	if pushURL == "" {
-		pushURL = fmt.Sprintf("https://x-access-token:%s@github.com/%s/%s.git", cfg.AccessToken, cfg.RepoOwner, cfg.RepoName)
-	}
-	if err := runGit("push", pushURL, branchName); err != nil {
-		return nil, "", fmt.Errorf("failed to push branch: %w", err)
+	if err := pushBranch(cfg, branchName, false); err != nil {
+		return nil, "", err
 	}
 
 	title := commitMessage
 	body := "Automated updates from main."
-	pr, err := client.CreatePullRequest(title, branchName, cfg.BaseBranch, body)
+	pr, err := client.CreatePullRequest(title, prHead(cfg, branchName), cfg.BaseBranch, body)
 	if err != nil {
 		return nil, "", fmt.Errorf("failed to create pull request: %w", err)
 	}
 
-	sha, err := gitHeadSHA()
+	sha, err := gitHeadSHA(cfg.WorkDir)
 	if err != nil {
 		return nil, "", err
 	}
 
+	logEvent("Opened pull request", "stage", "commit", "pr", pr.Number, "url", pr.HTMLURL, "sha", sha)
 	return pr, sha, nil
 }
 
+// commitChanges commits the pending changes with a message naming the base
+// branch and partition, and returns the message.
+func commitChanges(cfg config) (string, error) {
+	commitMessage := fmt.Sprintf("%s Merge from %s", cfg.CommitPrefix, cfg.BaseBranch)
+	if cfg.Partition != "" {
+		commitMessage = fmt.Sprintf("%s (%s)", commitMessage, cfg.Partition)
+	}
+	if err := stageAndCommit(cfg, commitMessage); err != nil {
+		return "", err
+	}
+	return commitMessage, nil
+}
+
+// stageAndCommit stages cfg.StagePaths (everything when empty) and commits
+// it with message.
+func stageAndCommit(cfg config, message string) error {
+	if err := ensureGitUser(cfg.WorkDir); err != nil {
+		return fmt.Errorf("failed to configure git user: %w", err)
+	}
+
+	addArgs := []string{"add", "--all"}
+	if len(cfg.StagePaths) > 0 {
+		// git add rejects pathspecs that match nothing, so stage the paths
+		// status resolved them to instead.
+		entries, err := gitStatus(cfg.WorkDir, cfg.StagePaths...)
+		if err != nil {
+			return err
+		}
+		addArgs = append(append(addArgs, "--"), literalPathspecs(entries)...)
+	}
+	if err := runGit(cfg.WorkDir, addArgs...); err != nil {
+		return fmt.Errorf("failed to add changes: %w", err)
+	}
+
+	if err := runGit(cfg.WorkDir, "commit", "-m", message); err != nil {
+		return fmt.Errorf("failed to commit changes: %w", err)
+	}
+	return nil
+}
+
+func pushBranch(cfg config, branchName string, force bool) error {
+	return pushTo(cfg, firstNonEmpty(cfg.PushRemote, originPushURL(cfg)), branchName, force)
+}
+
+// pushToOrigin pushes refspec to the repository itself, even when PR
+// branches go to a fork.
+func pushToOrigin(cfg config, refspec string) error {
+	return pushTo(cfg, originPushURL(cfg), refspec, false)
+}
+
+func pushTo(cfg config, pushURL, branchName string, force bool) error {
+	args := []string{"push"}
+	if force {
+		args = append(args, "--force")
+	}
+	args = append(args, pushURL, branchName)
+	if err := runGitRemote(cfg, cfg.WorkDir, args...); err != nil {
+		return fmt.Errorf("failed to push branch: %w", err)
+	}
+	return nil
+}
+
+func repoURL(cfg config) string {
+	return fmt.Sprintf("https://github.com/%s/%s.git", cfg.RepoOwner, cfg.RepoName)
+}
+
 // Wait pauses between PR creation and CI checks.
 func Wait(cfg config) {
 	wait := cfg.WaitSeconds
@@ -212,23 +713,33 @@ func WaitForCI(cfg config, client *GitHubClient, sha string) error {
 			return nil
 		}
 		if state == "failure" || state == "error" {
-			return fmt.Errorf("ci reported %s", state)
+			return newCIFailure(client, sha, state, status)
 		}
 		if time.Since(start) > timeout {
 			return fmt.Errorf("ci did not finish within %s", timeout)
 		}
 
-		log.Printf("CI status is %s; checking again in %s...\n", status.State, interval)
+		if jsonLogs {
+			slog.Info("Waiting for CI", "stage", "ci", "sha", sha, "ci_state", status.State, "interval", interval.String())
+		} else {
+			log.Printf("CI status is %s; checking again in %s...\n", status.State, interval)
+		}
 		time.Sleep(interval)
 	}
 }
 
-// Merge completes the PR using squash merge.
-func Merge(cfg config, client *GitHubClient, pr *PullRequest) error {
+// Merge completes the PR using squash merge, provided its head is still headSHA.
+func Merge(cfg config, client *GitHubClient, pr *PullRequest, headSHA string) error {
 	commitTitle := pr.Title
 	commitMessage := fmt.Sprintf("%s Squash merge by automation", cfg.CommitPrefix)
+	method := "squash"
+	if cfg.Mode == "merge" {
+		// Squashing would drop the base branch's history from the target.
+		commitMessage = fmt.Sprintf("%s Merge by automation", cfg.CommitPrefix)
+		method = "merge"
+	}
 
-	merged, err := client.MergePullRequest(pr.Number, commitTitle, commitMessage)
+	merged, err := client.MergePullRequest(pr.Number, commitTitle, commitMessage, headSHA, method)
 	if err != nil {
 		return err
 	}
@@ -239,9 +750,9 @@ func Merge(cfg config, client *GitHubClient, pr *PullRequest) error {
 }
 
 func loadConfig() (config, error) {
-	token := strings.TrimSpace(firstNonEmpty(os.Getenv("INPUT_GITHUB_ACCESS_TOKEN"), os.Getenv("GITHUB_ACCESS_TOKEN")))
-	if token == "" {
-		return config{}, errors.New("github access token is required")
+	token, err := loadAccessToken()
+	if err != nil {
+		return config{}, err
 	}
 
 	commitPrefix := strings.TrimSpace(os.Getenv("INPUT_COMMIT_PREFIX"))
@@ -249,16 +760,77 @@ func loadConfig() (config, error) {
 		commitPrefix = "[Auto Merge]"
 	}
 
+	mode := strings.ToLower(strings.TrimSpace(os.Getenv("INPUT_MODE")))
+	if mode == "" {
+		mode = "commands"
+	}
+	switch mode {
+	case "commands", "merge", "update-prs":
+	default:
+		return config{}, fmt.Errorf("invalid mode: %s", mode)
+	}
+
 	commandsRaw := os.Getenv("INPUT_COMMANDS")
 	commands := splitCommands(commandsRaw)
-	if len(commands) == 0 {
+	if mode == "commands" && len(commands) == 0 {
 		return config{}, errors.New("at least one command is required")
 	}
 
-	repo := os.Getenv("GITHUB_REPOSITORY")
-	parts := strings.Split(repo, "/")
-	if len(parts) != 2 {
-		return config{}, fmt.Errorf("invalid GITHUB_REPOSITORY: %s", repo)
+	mergeTargets := parseList(os.Getenv("INPUT_MERGE_TARGETS"))
+	if mode == "merge" && len(mergeTargets) == 0 {
+		return config{}, errors.New("merge_targets is required when mode is merge")
+	}
+
+	mergePush := strings.ToLower(strings.TrimSpace(os.Getenv("INPUT_MERGE_PUSH")))
+	if mergePush == "" {
+		mergePush = "pr"
+	}
+	if mergePush != "pr" && mergePush != "direct" {
+		return config{}, fmt.Errorf("invalid merge_push: %s", mergePush)
+	}
+
+	mergeConflicts := strings.ToLower(strings.TrimSpace(os.Getenv("INPUT_MERGE_CONFLICTS")))
+	if mergeConflicts == "" {
+		mergeConflicts = "report"
+	}
+	if mergeConflicts != "markers" && mergeConflicts != "report" {
+		return config{}, fmt.Errorf("invalid merge_conflicts: %s", mergeConflicts)
+	}
+
+	conflictStrategies, err := parseConflictStrategies(os.Getenv("INPUT_MERGE_CONFLICT_STRATEGIES"))
+	if err != nil {
+		return config{}, err
+	}
+
+	updatePRsMethod := strings.ToLower(strings.TrimSpace(os.Getenv("INPUT_UPDATE_PRS_METHOD")))
+	if updatePRsMethod == "" {
+		updatePRsMethod = "api"
+	}
+	if updatePRsMethod != "api" && updatePRsMethod != "merge" {
+		return config{}, fmt.Errorf("invalid update_prs_method: %s", updatePRsMethod)
+	}
+
+	commitToPR, err := parseBool(os.Getenv("INPUT_COMMIT_TO_PULL_REQUEST"))
+	if err != nil {
+		return config{}, fmt.Errorf("invalid commit_to_pull_request: %w", err)
+	}
+	if commitToPR && mode != "commands" {
+		return config{}, errors.New("commit_to_pull_request requires commands mode")
+	}
+
+	updatePRsDrafts := strings.ToLower(strings.TrimSpace(os.Getenv("INPUT_UPDATE_PRS_DRAFTS")))
+	if updatePRsDrafts == "" {
+		updatePRsDrafts = "include"
+	}
+	switch updatePRsDrafts {
+	case "include", "exclude", "only":
+	default:
+		return config{}, fmt.Errorf("invalid update_prs_drafts: %s", updatePRsDrafts)
+	}
+
+	owner, name, err := loadRepository()
+	if err != nil {
+		return config{}, err
 	}
 
 	baseBranch := os.Getenv("GITHUB_REF_NAME")
@@ -266,6 +838,43 @@ func loadConfig() (config, error) {
 		baseBranch = "main"
 	}
 
+	baseBranches := parseList(os.Getenv("INPUT_BASE_BRANCHES"))
+
+	repositories := parseList(os.Getenv("INPUT_REPOSITORIES"))
+	for _, r := range repositories {
+		if len(strings.Split(r, "/")) != 2 {
+			return config{}, fmt.Errorf("invalid repository %q: expected owner/repo", r)
+		}
+	}
+	if commitToPR && len(repositories) > 0 {
+		return config{}, errors.New("commit_to_pull_request cannot be combined with repositories: the triggering pull request belongs to this repository")
+	}
+
+	sshKey := strings.TrimSpace(os.Getenv("INPUT_SSH_KEY"))
+	sshKnownHosts := strings.TrimSpace(os.Getenv("INPUT_SSH_KNOWN_HOSTS"))
+	if sshKey != "" && sshKnownHosts == "" {
+		return config{}, errors.New("ssh_known_hosts is required when ssh_key is set")
+	}
+	if sshKey != "" && len(repositories) > 0 {
+		return config{}, errors.New("ssh_key cannot be combined with repositories: a deploy key only grants access to one repository")
+	}
+
+	pushRemote, pushOwner, pushRepo, err := parsePushRemote(os.Getenv("INPUT_PUSH_REMOTE"), sshKey != "")
+	if err != nil {
+		return config{}, err
+	}
+	if pushRemote != "" && len(repositories) > 0 {
+		return config{}, errors.New("push_remote cannot be combined with repositories")
+	}
+
+	maxParallel := 1
+	if raw := strings.TrimSpace(os.Getenv("INPUT_MAX_PARALLEL")); raw != "" {
+		maxParallel, err = strconv.Atoi(raw)
+		if err != nil || maxParallel < 1 {
+			return config{}, fmt.Errorf("invalid max_parallel: %s", raw)
+		}
+	}
+
 	prefixes := []string{"Auto Merge", "[Auto Merge]:", commitPrefix}
 	extraPrefixes := parsePrefixes(os.Getenv("PREFIXES_TO_IGNORE"))
 	prefixes = append(prefixes, extraPrefixes...)
@@ -273,64 +882,341 @@ func loadConfig() (config, error) {
 	runPrefixes := parsePrefixes(os.Getenv("PREFIXES_TO_RUN_ON"))
 	runContains := parsePrefixes(os.Getenv("CONTAINS_TO_RUN_ON"))
 
+	closeOnFailure, err := parseBool(os.Getenv("INPUT_CLOSE_PR_ON_FAILURE"))
+	if err != nil {
+		return config{}, fmt.Errorf("invalid close_pr_on_failure: %w", err)
+	}
+
+	trackFailures, err := parseBool(os.Getenv("INPUT_TRACK_FAILURES"))
+	if err != nil {
+		return config{}, fmt.Errorf("invalid track_failures: %w", err)
+	}
+
+	failureLabel := strings.TrimSpace(os.Getenv("INPUT_FAILURE_ISSUE_LABEL"))
+	if failureLabel == "" {
+		failureLabel = "auto-merge-failure"
+	}
+
+	baseMovedStrategy := strings.ToLower(strings.TrimSpace(os.Getenv("INPUT_BASE_MOVED_STRATEGY")))
+	if baseMovedStrategy == "" {
+		baseMovedStrategy = "update-branch"
+	}
+	switch baseMovedStrategy {
+	case "update-branch", "rerun", "ignore":
+	default:
+		return config{}, fmt.Errorf("invalid base_moved_strategy: %s", baseMovedStrategy)
+	}
+
+	baseMovedMaxAttempts := 3
+	if raw := strings.TrimSpace(os.Getenv("INPUT_BASE_MOVED_MAX_ATTEMPTS")); raw != "" {
+		baseMovedMaxAttempts, err = strconv.Atoi(raw)
+		if err != nil || baseMovedMaxAttempts < 1 {
+			return config{}, fmt.Errorf("invalid base_moved_max_attempts: %s", raw)
+		}
+	}
+
+	lockMode := strings.ToLower(strings.TrimSpace(os.Getenv("INPUT_LOCK_MODE")))
+	if lockMode == "" {
+		lockMode = "none"
+	}
+	switch lockMode {
+	case "none", "wait", "cancel-older":
+	default:
+		return config{}, fmt.Errorf("invalid lock_mode: %s", lockMode)
+	}
+
+	lockStaleAfter, err := parseDuration(os.Getenv("INPUT_LOCK_STALE_AFTER"), time.Hour)
+	if err != nil {
+		return config{}, fmt.Errorf("invalid lock_stale_after: %w", err)
+	}
+
+	lockWaitTimeout, err := parseDuration(os.Getenv("INPUT_LOCK_WAIT_TIMEOUT"), 30*time.Minute)
+	if err != nil {
+		return config{}, fmt.Errorf("invalid lock_wait_timeout: %w", err)
+	}
+
+	partitionBy := strings.ToLower(strings.TrimSpace(os.Getenv("INPUT_PARTITION_BY")))
+	switch partitionBy {
+	case "", "paths", "codeowners":
+	default:
+		return config{}, fmt.Errorf("invalid partition_by: %s", partitionBy)
+	}
+
+	partitionPaths := parseList(os.Getenv("INPUT_PARTITION_PATHS"))
+	if partitionBy == "paths" && len(partitionPaths) == 0 {
+		return config{}, errors.New("partition_paths is required when partition_by is paths")
+	}
+
+	directPush, err := parseBool(os.Getenv("INPUT_DIRECT_PUSH"))
+	if err != nil {
+		return config{}, fmt.Errorf("invalid direct_push: %w", err)
+	}
+	if directPush && partitionBy != "" {
+		return config{}, errors.New("direct_push cannot be combined with partition_by")
+	}
+
+	logFormat := strings.ToLower(strings.TrimSpace(os.Getenv("INPUT_LOG_FORMAT")))
+	if logFormat == "" {
+		logFormat = "text"
+	}
+	if logFormat != "text" && logFormat != "json" {
+		return config{}, fmt.Errorf("invalid log_format: %s", logFormat)
+	}
+
+	maxChangedFiles, err := parseLimit("max_changed_files")
+	if err != nil {
+		return config{}, err
+	}
+	maxAddedLines, err := parseLimit("max_added_lines")
+	if err != nil {
+		return config{}, err
+	}
+	maxRemovedLines, err := parseLimit("max_removed_lines")
+	if err != nil {
+		return config{}, err
+	}
+
+	safeguardAction := strings.ToLower(strings.TrimSpace(os.Getenv("INPUT_SAFEGUARD_ACTION")))
+	if safeguardAction == "" {
+		safeguardAction = "fail"
+	}
+	if safeguardAction != "fail" && safeguardAction != "pr-only" {
+		return config{}, fmt.Errorf("invalid safeguard_action: %s", safeguardAction)
+	}
+
+	strict, err := parseBool(os.Getenv("INPUT_STRICT"))
+	if err != nil {
+		return config{}, fmt.Errorf("invalid strict: %w", err)
+	}
+
+	exposeToken, err := parseBool(os.Getenv("INPUT_EXPOSE_TOKEN_TO_COMMANDS"))
+	if err != nil {
+		return config{}, fmt.Errorf("invalid expose_token_to_commands: %w", err)
+	}
+
+	includePaths := parseList(os.Getenv("INPUT_INCLUDE_PATHS"))
+	excludePaths := parseList(os.Getenv("INPUT_EXCLUDE_PATHS"))
+
 	return config{
-		AccessToken:    token,
-		CommitPrefix:   commitPrefix,
-		Commands:       commands,
-		RepoOwner:      parts[0],
-		RepoName:       parts[1],
-		BaseBranch:     baseBranch,
-		IgnorePrefixes: prefixes,
-		RunOnPrefixes:  runPrefixes,
-		RunOnContains:  runContains,
-		WaitSeconds:    30,
-		CIWaitTimeout:  15 * time.Minute,
-		CIWaitInterval: 10 * time.Second,
-		PushRemote:     "",
+		AccessToken:          token,
+		CommitPrefix:         commitPrefix,
+		Commands:             commands,
+		RepoOwner:            owner,
+		RepoName:             name,
+		BaseBranch:           baseBranch,
+		BaseBranches:         baseBranches,
+		IgnorePrefixes:       prefixes,
+		RunOnPrefixes:        runPrefixes,
+		RunOnContains:        runContains,
+		WaitSeconds:          30,
+		CIWaitTimeout:        15 * time.Minute,
+		CIWaitInterval:       10 * time.Second,
+		PushRemote:           pushRemote,
+		CloseOnCIFailure:     closeOnFailure,
+		TrackFailures:        trackFailures,
+		FailureLabel:         failureLabel,
+		BaseMovedStrategy:    baseMovedStrategy,
+		BaseMovedMaxAttempts: baseMovedMaxAttempts,
+		LockMode:             lockMode,
+		LockStaleAfter:       lockStaleAfter,
+		LockWaitTimeout:      lockWaitTimeout,
+		Repositories:         repositories,
+		MaxParallel:          maxParallel,
+		PartitionBy:          partitionBy,
+		PartitionPaths:       partitionPaths,
+		MaskEnv:              parseList(os.Getenv("INPUT_MASK_ENV")),
+		LogFormat:            logFormat,
+		MaxChangedFiles:      maxChangedFiles,
+		MaxAddedLines:        maxAddedLines,
+		MaxRemovedLines:      maxRemovedLines,
+		ForbiddenPaths:       parseList(os.Getenv("INPUT_FORBIDDEN_PATHS")),
+		AllowedPaths:         parseList(os.Getenv("INPUT_ALLOWED_PATHS")),
+		SafeguardAction:      safeguardAction,
+		IncludePaths:         includePaths,
+		ExcludePaths:         excludePaths,
+		StagePaths:           stagePathspecs(includePaths, excludePaths),
+		Strict:               strict,
+		AllowedUntracked:     parseList(os.Getenv("INPUT_ALLOWED_UNTRACKED_PATHS")),
+		CommandEnv:           parseList(os.Getenv("INPUT_COMMAND_ENV")),
+		ExposeToken:          exposeToken,
+		Mode:                 mode,
+		MergeTargets:         mergeTargets,
+		MergePush:            mergePush,
+		MergeConflicts:       mergeConflicts,
+		ConflictStrategies:   conflictStrategies,
+		UpdatePRsMethod:      updatePRsMethod,
+		UpdatePRsLabels:      parseList(os.Getenv("INPUT_UPDATE_PRS_LABELS")),
+		UpdatePRsAuthors:     parseList(os.Getenv("INPUT_UPDATE_PRS_AUTHORS")),
+		UpdatePRsDrafts:      updatePRsDrafts,
+		CommitToPR:           commitToPR,
+		DirectPush:           directPush,
+		PushOwner:            pushOwner,
+		PushRepo:             pushRepo,
+		SSHKey:               sshKey,
+		SSHKnownHosts:        sshKnownHosts,
 	}, nil
 }
 
-func latestCommitMessage() (string, error) {
-	out, err := exec.Command("git", "log", "-1", "--pretty=%s").Output()
+func loadAccessToken() (string, error) {
+	token := strings.TrimSpace(firstNonEmpty(os.Getenv("INPUT_GITHUB_ACCESS_TOKEN"), os.Getenv("GITHUB_ACCESS_TOKEN")))
+	if token == "" {
+		return "", errors.New("github access token is required")
+	}
+	return token, nil
+}
+
+func loadRepository() (string, string, error) {
+	repo := os.Getenv("GITHUB_REPOSITORY")
+	parts := strings.Split(repo, "/")
+	if len(parts) != 2 {
+		return "", "", fmt.Errorf("invalid GITHUB_REPOSITORY: %s", repo)
+	}
+	return parts[0], parts[1], nil
+}
+
+func latestCommitMessage(dir string) (string, error) {
+	out, err := gitOutput(dir, "log", "-1", "--pretty=%s")
 	if err != nil {
 		return "", fmt.Errorf("failed to get latest commit message: %w", err)
 	}
 	return strings.TrimSpace(string(out)), nil
 }
 
-func hasChanges() (bool, error) {
-	out, err := exec.Command("git", "status", "--porcelain").Output()
+// hasChanges reports whether the working tree differs from HEAD, limited to
+// pathspecs when any are given.
+func hasChanges(dir string, pathspecs ...string) (bool, error) {
+	entries, err := gitStatus(dir, pathspecs...)
 	if err != nil {
-		return false, fmt.Errorf("failed to check git status: %w", err)
+		return false, err
 	}
-	return strings.TrimSpace(string(out)) != "", nil
+	return len(entries) > 0, nil
+}
+
+// statusEntry is one line of `git status --porcelain`.
+type statusEntry struct {
+	Index    byte
+	Worktree byte
+	Path     string
+	OrigPath string
 }
 
-func runGit(args ...string) error {
+// gitStatus lists changed and untracked files, limited to pathspecs when any
+// are given. Untracked directories are expanded to individual files.
+func gitStatus(dir string, pathspecs ...string) ([]statusEntry, error) {
+	args := []string{"status", "--porcelain", "-z", "--untracked-files=all"}
+	if len(pathspecs) > 0 {
+		args = append(append(args, "--"), pathspecs...)
+	}
+	out, err := gitOutput(dir, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check git status: %w", err)
+	}
+	return parseStatus(string(out)), nil
+}
+
+// parseStatus parses `git status --porcelain -z` output. Renames and copies
+// carry their original path in the following field.
+func parseStatus(out string) []statusEntry {
+	var entries []statusEntry
+	fields := strings.Split(out, "\x00")
+	for i := 0; i < len(fields); i++ {
+		field := fields[i]
+		if len(field) < 4 {
+			continue
+		}
+		entry := statusEntry{Index: field[0], Worktree: field[1], Path: field[3:]}
+		if entry.Index == 'R' || entry.Index == 'C' {
+			if i+1 < len(fields) {
+				entry.OrigPath = fields[i+1]
+				i++
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// runGit runs git in dir, streaming its redacted output. An empty dir means
+// the current working directory.
+func runGit(dir string, args ...string) error {
+	return runGitEnv(dir, nil, args...)
+}
+
+// runGitRemote runs a git command that talks to GitHub. The token is supplied
+// as an HTTP header through GIT_CONFIG_* variables scoped to this command, so
+// it never appears in argv, remote URLs or .git/config. SSH remotes use the
+// deploy key, when one is configured.
+func runGitRemote(cfg config, dir string, args ...string) error {
+	env := gitAuthEnv(cfg.AccessToken)
+	if cfg.SSHCommand != "" {
+		env = append(env, "GIT_SSH_COMMAND="+cfg.SSHCommand)
+	}
+	return runGitEnv(dir, env, args...)
+}
+
+func runGitEnv(dir string, env []string, args ...string) error {
 	cmd := exec.Command("git", args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	return cmd.Run()
+	cmd.Dir = dir
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	stdout := newRedactingWriter(os.Stdout)
+	stderr := newRedactingWriter(os.Stderr)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	err := cmd.Run()
+	stdout.Flush()
+	stderr.Flush()
+	return err
+}
+
+// gitAuthEnv first resets any extra header persisted by actions/checkout
+// (two Authorization headers make GitHub reject the request) and then adds
+// one carrying the token.
+func gitAuthEnv(token string) []string {
+	const key = "http.https://github.com/.extraheader"
+	return []string{
+		"GIT_CONFIG_COUNT=2",
+		"GIT_CONFIG_KEY_0=" + key,
+		"GIT_CONFIG_VALUE_0=",
+		"GIT_CONFIG_KEY_1=" + key,
+		"GIT_CONFIG_VALUE_1=" + gitAuthHeader(token),
+	}
 }
 
-func gitHeadSHA() (string, error) {
-	out, err := exec.Command("git", "rev-parse", "HEAD").Output()
+func gitAuthHeader(token string) string {
+	return "AUTHORIZATION: basic " + gitBasicCredentials(token)
+}
+
+func gitBasicCredentials(token string) string {
+	return base64.StdEncoding.EncodeToString([]byte("x-access-token:" + token))
+}
+
+// gitOutput runs git in dir and returns its stdout.
+func gitOutput(dir string, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	return cmd.Output()
+}
+
+func gitHeadSHA(dir string) (string, error) {
+	out, err := gitOutput(dir, "rev-parse", "HEAD")
 	if err != nil {
 		return "", fmt.Errorf("failed to get head sha: %w", err)
 	}
 	return strings.TrimSpace(string(out)), nil
 }
 
-func ensureGitUser() error {
+func ensureGitUser(dir string) error {
 	user := os.Getenv("GITHUB_ACTOR")
 	if user == "" {
 		user = "github-actions"
 	}
 	email := fmt.Sprintf("%s@users.noreply.github.com", user)
-	if err := runGit("config", "user.name", user); err != nil {
+	if err := runGit(dir, "config", "user.name", user); err != nil {
 		return err
 	}
-	return runGit("config", "user.email", email)
+	return runGit(dir, "config", "user.email", email)
 }
 
 func splitCommands(raw string) []string {
@@ -346,6 +1232,15 @@ func splitCommands(raw string) []string {
 	return cmds
 }
 
+// parseList splits a newline or comma separated input.
+func parseList(raw string) []string {
+	var items []string
+	for _, line := range strings.Split(raw, "\n") {
+		items = append(items, parsePrefixes(line)...)
+	}
+	return items
+}
+
 func parsePrefixes(raw string) []string {
 	if strings.TrimSpace(raw) == "" {
 		return nil
@@ -360,6 +1255,66 @@ func parsePrefixes(raw string) []string {
 	return prefixes
 }
 
+// parseBool treats an empty value as false.
+func parseBool(raw string) (bool, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(raw)
+}
+
+// stagePathspecs turns include/exclude inputs into git pathspecs. Nil means
+// every path.
+func stagePathspecs(include, exclude []string) []string {
+	if len(include) == 0 && len(exclude) == 0 {
+		return nil
+	}
+	specs := append([]string{}, include...)
+	if len(specs) == 0 {
+		specs = []string{"."}
+	}
+	for _, e := range exclude {
+		specs = append(specs, ":(exclude)"+e)
+	}
+	return specs
+}
+
+// literalPathspecs matches exactly the paths in entries, including the
+// source of renames and copies.
+func literalPathspecs(entries []statusEntry) []string {
+	var specs []string
+	for _, e := range entries {
+		specs = append(specs, ":(literal)"+e.Path)
+		if e.OrigPath != "" {
+			specs = append(specs, ":(literal)"+e.OrigPath)
+		}
+	}
+	return specs
+}
+
+// parseLimit reads a non-negative integer input; empty or 0 means no limit.
+func parseLimit(name string) (int, error) {
+	raw := strings.TrimSpace(os.Getenv("INPUT_" + strings.ToUpper(name)))
+	if raw == "" {
+		return 0, nil
+	}
+	limit, err := strconv.Atoi(raw)
+	if err != nil || limit < 0 {
+		return 0, fmt.Errorf("invalid %s: %s", name, raw)
+	}
+	return limit, nil
+}
+
+// parseDuration returns fallback for an empty value.
+func parseDuration(raw string, fallback time.Duration) (time.Duration, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return fallback, nil
+	}
+	return time.ParseDuration(raw)
+}
+
 func firstNonEmpty(values ...string) string {
 	for _, v := range values {
 		if strings.TrimSpace(v) != "" {
@@ -370,6 +1325,6 @@ func firstNonEmpty(values ...string) string {
 }
 
 func fail(err error) {
-	log.Println(err)
+	annotateError(err)
 	os.Exit(1)
 }
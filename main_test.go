@@ -0,0 +1,124 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStagePathspecs(t *testing.T) {
+	tests := []struct {
+		name             string
+		include, exclude []string
+		want             []string
+	}{
+		{name: "everything", want: nil},
+		{name: "include only", include: []string{"docs", "*.md"}, want: []string{"docs", "*.md"}},
+		{name: "exclude only", exclude: []string{"vendor"}, want: []string{".", ":(exclude)vendor"}},
+		{
+			name:    "include and exclude",
+			include: []string{"src"},
+			exclude: []string{"src/gen", "*.lock"},
+			want:    []string{"src", ":(exclude)src/gen", ":(exclude)*.lock"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := stagePathspecs(tt.include, tt.exclude); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("stagePathspecs(%q, %q) = %q, want %q", tt.include, tt.exclude, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLiteralPathspecs(t *testing.T) {
+	entries := []statusEntry{
+		{Index: '?', Worktree: '?', Path: "docs/[draft].md"},
+		{Index: 'R', Path: "new.go", OrigPath: "old.go"},
+	}
+	want := []string{":(literal)docs/[draft].md", ":(literal)new.go", ":(literal)old.go"}
+	if got := literalPathspecs(entries); !reflect.DeepEqual(got, want) {
+		t.Errorf("literalPathspecs() = %q, want %q", got, want)
+	}
+}
+
+func TestStageAndCommitIgnoresUnmatchedIncludePaths(t *testing.T) {
+	dir := testRepo(t)
+	writeFiles(t, dir, map[string]string{"docs/a.md": "x\n", "other.txt": "x\n"})
+
+	cfg := config{WorkDir: dir, StagePaths: stagePathspecs([]string{"docs", "missing"}, nil)}
+	if err := stageAndCommit(cfg, "test"); err != nil {
+		t.Fatalf("stageAndCommit() = %v", err)
+	}
+
+	out, err := gitOutput(dir, "show", "--name-only", "--format=", "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(out); got != "docs/a.md\n" {
+		t.Errorf("committed files = %q, want %q", got, "docs/a.md\n")
+	}
+}
+
+func TestLoadConfigRejectsSingleRepositoryOptions(t *testing.T) {
+	tests := []struct {
+		name, input, value, want string
+	}{
+		{name: "commit to pull request", input: "INPUT_COMMIT_TO_PULL_REQUEST", value: "true", want: "commit_to_pull_request cannot be combined with repositories"},
+		{name: "push remote", input: "INPUT_PUSH_REMOTE", value: "someone/fork", want: "push_remote cannot be combined with repositories"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("GITHUB_REPOSITORY", "owner/repo")
+			t.Setenv("INPUT_GITHUB_ACCESS_TOKEN", "token")
+			t.Setenv("INPUT_COMMANDS", "make generate")
+			t.Setenv("INPUT_REPOSITORIES", "owner/one, owner/two")
+			t.Setenv(tt.input, tt.value)
+			if _, err := loadConfig(); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("loadConfig() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+// testRepo creates a git repository with an empty initial commit, skipping
+// the test when git is not installed.
+func testRepo(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	dir := t.TempDir()
+	testGit(t, dir, "init", "-q")
+	testGit(t, dir, "config", "user.name", "test")
+	testGit(t, dir, "config", "user.email", "test@example.com")
+	testGit(t, dir, "commit", "-q", "--allow-empty", "-m", "init")
+	return dir
+}
+
+// testGit runs git in dir and returns its trimmed output.
+func testGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v: %v\n%s", args, err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// writeFiles writes files, keyed by slash-separated path, under dir.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
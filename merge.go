@@ -0,0 +1,288 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// mergeConflictMarker tags conflict reports so each source commit is
+// reported on a PR at most once.
+const mergeConflictMarker = "<!-- merge-from-main:merge-conflicts %s -->"
+
+// conflictPRMarker identifies the PR markers mode opened for conflicts
+// with a source branch, so later runs reuse it.
+const conflictPRMarker = "<!-- merge-from-main:conflict-pr %s -->"
+
+// runMergeTarget merges cfg.MergeSource into cfg.BaseBranch. Clean merges are
+// pushed directly or delivered through a PR like command output; conflicting
+// merges are opened as a PR for someone to resolve.
+func runMergeTarget(cfg config, client *GitHubClient) []TargetResult {
+	cfg.WorkBranch = fmt.Sprintf("auto-merge-%d-%s", time.Now().Unix(), sanitizeRefComponent(cfg.BaseBranch))
+	result := TargetResult{Repository: cfg.RepoOwner + "/" + cfg.RepoName, Branch: cfg.BaseBranch}
+	failed := func(stage string, err error) []TargetResult {
+		result.Outcome = OutcomeFailed
+		result.Err = &StageError{Stage: stage, Err: err}
+		return []TargetResult{result}
+	}
+
+	var sourceSHA, targetSHA string
+	err := runStage("checkout", "Check out "+cfg.BaseBranch, func() error {
+		var err error
+		sourceSHA, err = fetchMergeSource(cfg)
+		if err != nil {
+			return err
+		}
+		targetSHA, err = checkoutLatestBase(cfg)
+		return err
+	}, "branch", cfg.BaseBranch)
+	if err != nil {
+		return failed("checkout", err)
+	}
+
+	if _, err := gitOutput(cfg.WorkDir, "merge-base", "--is-ancestor", sourceSHA, targetSHA); err == nil {
+		notice(fmt.Sprintf("%s already contains %s. Nothing to merge.", cfg.BaseBranch, cfg.MergeSource))
+		result.Outcome = OutcomeNoChanges
+		return []TargetResult{result}
+	}
+
+	var resolved []conflictResolution
+	var conflicts []string
+	err = runStage("merge", fmt.Sprintf("Merge %s into %s", cfg.MergeSource, cfg.BaseBranch), func() error {
+		var err error
+		resolved, conflicts, err = mergeSource(cfg, sourceSHA)
+		return err
+	}, "branch", cfg.BaseBranch, "sha", sourceSHA)
+	if err != nil {
+		return failed("merge", err)
+	}
+
+	if len(conflicts) > 0 {
+		log.Printf("Merging %s into %s conflicts in %d files.\n", cfg.MergeSource, cfg.BaseBranch, len(conflicts))
+		var pr *PullRequest
+		err := runStage("commit", "Open conflict pull request for "+cfg.BaseBranch, func() error {
+			var err error
+			if cfg.MergeConflicts == "markers" {
+				pr, err = openConflictPR(cfg, client, sourceSHA, conflicts, resolved)
+			} else {
+				pr, err = reportConflicts(cfg, client, sourceSHA, conflicts, resolved)
+			}
+			return err
+		}, "branch", cfg.BaseBranch)
+		if err != nil {
+			return failed("commit", err)
+		}
+		notice(fmt.Sprintf("Merging %s into %s conflicts; resolve PR #%d.", cfg.MergeSource, cfg.BaseBranch, pr.Number))
+		result.PR = pr
+		result.Outcome = OutcomeOpened
+		return []TargetResult{result}
+	}
+	for _, r := range resolved {
+		log.Printf("Resolved conflict in %s: %s.\n", r.Path, r.Strategy.Label())
+	}
+
+	if cfg.MergePush == "direct" {
+		err := runStage("push", "Push merge to "+cfg.BaseBranch, func() error {
+			return pushToOrigin(cfg, "HEAD:refs/heads/"+cfg.BaseBranch)
+		}, "branch", cfg.BaseBranch)
+		if err != nil {
+			return failed("push", err)
+		}
+		log.Printf("Merged %s into %s.\n", cfg.MergeSource, cfg.BaseBranch)
+		result.Outcome = OutcomeMerged
+		return []TargetResult{result}
+	}
+
+	var pr *PullRequest
+	var headSHA string
+	err = runStage("commit", "Open pull request for "+cfg.BaseBranch, func() error {
+		var err error
+		body := "Automated merge of " + cfg.MergeSource + ".\n" + resolutionReport("Conflicts resolved automatically:", resolved)
+		pr, headSHA, err = openMergePR(cfg, client, mergeCommitMessage(cfg), body)
+		return err
+	}, "branch", cfg.BaseBranch)
+	if err != nil {
+		return failed("commit", err)
+	}
+	result.PR = pr
+	result.Outcome, result.Err = deliverPullRequest(cfg, client, pr, headSHA, targetSHA)
+	return []TargetResult{result}
+}
+
+// fetchMergeSource fetches the latest source branch, deepening a shallow
+// clone first because merging needs the branches' common history.
+func fetchMergeSource(cfg config) (string, error) {
+	out, err := gitOutput(cfg.WorkDir, "rev-parse", "--is-shallow-repository")
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect repository: %w", err)
+	}
+	if strings.TrimSpace(string(out)) == "true" {
+		if err := runGitRemote(cfg, cfg.WorkDir, "fetch", "--unshallow", "origin"); err != nil {
+			return "", fmt.Errorf("failed to fetch full history: %w", err)
+		}
+	}
+	if err := runGitRemote(cfg, cfg.WorkDir, "fetch", "origin", cfg.MergeSource); err != nil {
+		return "", fmt.Errorf("failed to fetch %s: %w", cfg.MergeSource, err)
+	}
+	out, err = gitOutput(cfg.WorkDir, "rev-parse", "FETCH_HEAD")
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s: %w", cfg.MergeSource, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// mergeSource merges sourceSHA into the checked-out target, applying the
+// configured conflict strategies, and returns the resolutions and the paths
+// still conflicting. The merge is left in progress when conflicts remain.
+func mergeSource(cfg config, sourceSHA string) ([]conflictResolution, []string, error) {
+	if err := ensureGitUser(cfg.WorkDir); err != nil {
+		return nil, nil, fmt.Errorf("failed to configure git user: %w", err)
+	}
+
+	mergeErr := runGit(cfg.WorkDir, "merge", "--no-ff", "--no-edit", "-m", mergeCommitMessage(cfg), sourceSHA)
+	if mergeErr == nil {
+		return nil, nil, nil
+	}
+
+	out, err := gitOutput(cfg.WorkDir, "diff", "--name-only", "--diff-filter=U")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list conflicts: %w", err)
+	}
+	conflicts := splitLines(string(out))
+	if len(conflicts) == 0 {
+		return nil, nil, fmt.Errorf("failed to merge %s: %w", cfg.MergeSource, mergeErr)
+	}
+
+	resolved, remaining, err := resolveConflicts(cfg, conflicts)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(remaining) == 0 {
+		if err := runGit(cfg.WorkDir, "commit", "--no-edit", "-m", mergeCommitMessage(cfg)); err != nil {
+			return nil, nil, fmt.Errorf("failed to commit merge: %w", err)
+		}
+	}
+	return resolved, remaining, nil
+}
+
+func mergeCommitMessage(cfg config) string {
+	return fmt.Sprintf("%s Merge %s into %s", cfg.CommitPrefix, cfg.MergeSource, cfg.BaseBranch)
+}
+
+// openMergePR pushes the merge commit at HEAD to the work branch and opens a
+// PR against the target.
+func openMergePR(cfg config, client *GitHubClient, title, body string) (*PullRequest, string, error) {
+	if err := runGit(cfg.WorkDir, "checkout", "-b", cfg.WorkBranch); err != nil {
+		return nil, "", fmt.Errorf("failed to create branch: %w", err)
+	}
+	if err := pushBranch(cfg, cfg.WorkBranch, false); err != nil {
+		return nil, "", err
+	}
+
+	pr, err := client.CreatePullRequest(title, prHead(cfg, cfg.WorkBranch), cfg.BaseBranch, body)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create pull request: %w", err)
+	}
+
+	sha, err := gitHeadSHA(cfg.WorkDir)
+	if err != nil {
+		return nil, "", err
+	}
+	logEvent("Opened pull request", "stage", "commit", "pr", pr.Number, "url", pr.HTMLURL, "sha", sha)
+	return pr, sha, nil
+}
+
+// openConflictPR commits the conflicted merge, markers included, so the
+// conflicts can be resolved on the PR branch. While an earlier conflict PR
+// for the target is still open, it is commented on instead, once per source
+// commit.
+func openConflictPR(cfg config, client *GitHubClient, sourceSHA string, conflicts []string, resolved []conflictResolution) (*PullRequest, error) {
+	existing, err := findConflictPR(cfg, client)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		if err := runGit(cfg.WorkDir, "merge", "--abort"); err != nil {
+			return nil, fmt.Errorf("failed to abort merge: %w", err)
+		}
+		body := conflictReport(cfg, conflicts) +
+			resolutionReport("Conflicts resolved automatically:", resolved) +
+			fmt.Sprintf("\n`%s` has moved on. Merge it into this branch again while resolving.\n", cfg.MergeSource)
+		return existing, commentOnce(client, existing, mergeConflictMarker, sourceSHA, body)
+	}
+
+	if err := runGit(cfg.WorkDir, "add", "--all"); err != nil {
+		return nil, fmt.Errorf("failed to add conflicts: %w", err)
+	}
+	if err := runGit(cfg.WorkDir, "commit", "--no-edit", "-m", mergeCommitMessage(cfg)+" (conflicts)"); err != nil {
+		return nil, fmt.Errorf("failed to commit conflicts: %w", err)
+	}
+
+	body := conflictReport(cfg, conflicts) +
+		resolutionReport("Conflicts resolved automatically:", resolved) +
+		"\nThis branch contains the merge with conflict markers. Resolve them on this branch before merging.\n" +
+		"\n" + fmt.Sprintf(conflictPRMarker, cfg.MergeSource) + "\n" + fmt.Sprintf(mergeConflictMarker, sourceSHA) + "\n"
+	pr, _, err := openMergePR(cfg, client, mergeCommitMessage(cfg)+" (conflicts)", body)
+	return pr, err
+}
+
+// findConflictPR returns the open conflict PR markers mode opened against
+// the target, or nil.
+func findConflictPR(cfg config, client *GitHubClient) (*PullRequest, error) {
+	prs, err := client.ListOpenPullRequests(cfg.BaseBranch)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pull requests: %w", err)
+	}
+	marker := fmt.Sprintf(conflictPRMarker, cfg.MergeSource)
+	for i := range prs {
+		if strings.Contains(prs[i].Body, marker) {
+			return &prs[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// reportConflicts aborts the merge and opens a PR from the source branch
+// itself, so GitHub shows the conflicts. An existing PR between the two
+// branches gets the report as a comment instead, once per source commit.
+// Aborting discards any strategy resolutions, so those paths are listed as
+// needing resolution too.
+func reportConflicts(cfg config, client *GitHubClient, sourceSHA string, conflicts []string, resolved []conflictResolution) (*PullRequest, error) {
+	if err := runGit(cfg.WorkDir, "merge", "--abort"); err != nil {
+		return nil, fmt.Errorf("failed to abort merge: %w", err)
+	}
+
+	body := conflictReport(cfg, conflicts) +
+		resolutionReport("These conflicts have a configured strategy and must be resolved the same way:", resolved) + fmt.Sprintf(
+		"\nResolve them locally and push the result to `%s`:\n\n```sh\ngit checkout %s\ngit merge origin/%s\n```\n",
+		cfg.BaseBranch, cfg.BaseBranch, cfg.MergeSource)
+
+	prs, err := client.ListPullRequestsForBranch(cfg.MergeSource, "open")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pull requests: %w", err)
+	}
+	for i := range prs {
+		if prs[i].Base.Ref == cfg.BaseBranch {
+			return &prs[i], commentOnce(client, &prs[i], mergeConflictMarker, sourceSHA, body)
+		}
+	}
+
+	body += "\n" + fmt.Sprintf(mergeConflictMarker, sourceSHA) + "\n"
+	pr, err := client.CreatePullRequest(mergeCommitMessage(cfg)+" (conflicts)", cfg.MergeSource, cfg.BaseBranch, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create pull request: %w", err)
+	}
+	logEvent("Opened pull request", "stage", "commit", "pr", pr.Number, "url", pr.HTMLURL)
+	return pr, nil
+}
+
+// conflictReport lists the conflicting files as Markdown.
+func conflictReport(cfg config, conflicts []string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Merging `%s` into `%s` conflicts in %d file(s):\n\n", cfg.MergeSource, cfg.BaseBranch, len(conflicts))
+	for _, path := range conflicts {
+		fmt.Fprintf(&b, "- `%s`\n", path)
+	}
+	return b.String()
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	otherPartition   = "other"
+	unownedPartition = "unowned"
+)
+
+// codeownersLocations are searched in the order GitHub uses.
+var codeownersLocations = []string{".github/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS"}
+
+// Partition is a subset of the changes committed and merged as its own PR.
+type Partition struct {
+	Name      string
+	Pathspecs []string
+}
+
+// PartitionChanges splits the working tree changes by cfg.PartitionBy.
+func PartitionChanges(cfg config) ([]Partition, error) {
+	entries, err := gitStatus(cfg.WorkDir, cfg.StagePaths...)
+	if err != nil {
+		return nil, err
+	}
+
+	var partitions []Partition
+	switch cfg.PartitionBy {
+	case "paths":
+		partitions = partitionByPaths(cfg.PartitionPaths, entries)
+		if len(cfg.IncludePaths) > 0 {
+			// Git pathspecs cannot intersect a root with the include list, so
+			// pin each partition to the files it contains right now.
+			partitions = literalPartitions(partitions, cfg.PartitionPaths, entries)
+		} else {
+			for i := range partitions {
+				for _, e := range cfg.ExcludePaths {
+					partitions[i].Pathspecs = append(partitions[i].Pathspecs, ":(exclude)"+e)
+				}
+			}
+		}
+	case "codeowners":
+		rules, err := loadCodeowners(cfg.WorkDir)
+		if err != nil {
+			return nil, err
+		}
+		partitions = partitionByOwners(rules, entries)
+	default:
+		return nil, fmt.Errorf("unknown partition mode: %s", cfg.PartitionBy)
+	}
+
+	names := make([]string, 0, len(partitions))
+	for _, p := range partitions {
+		names = append(names, p.Name)
+	}
+	log.Printf("Changes split into %d partitions: %s\n", len(partitions), strings.Join(names, ", "))
+	return partitions, nil
+}
+
+// partitionByPaths groups changes under the longest matching root. Changes
+// outside every root form an "other" partition.
+func partitionByPaths(roots []string, entries []statusEntry) []Partition {
+	cleaned := make([]string, 0, len(roots))
+	for _, root := range roots {
+		cleaned = append(cleaned, strings.Trim(filepath.ToSlash(root), "/"))
+	}
+
+	used := map[string]bool{}
+	hasOther := false
+	for _, entry := range entries {
+		for _, p := range entryPaths(entry) {
+			if root := longestRoot(cleaned, p); root != "" {
+				used[root] = true
+			} else {
+				hasOther = true
+			}
+		}
+	}
+
+	var partitions []Partition
+	for _, root := range cleaned {
+		if used[root] {
+			partitions = append(partitions, Partition{Name: root, Pathspecs: []string{root}})
+			delete(used, root)
+		}
+	}
+	if hasOther {
+		other := Partition{Name: otherPartition, Pathspecs: []string{"."}}
+		for _, root := range cleaned {
+			other.Pathspecs = append(other.Pathspecs, ":(exclude)"+root)
+		}
+		partitions = append(partitions, other)
+	}
+	return partitions
+}
+
+// literalPartitions replaces each partition's pathspecs with the literal files
+// assigned to it.
+func literalPartitions(partitions []Partition, roots []string, entries []statusEntry) []Partition {
+	cleaned := make([]string, 0, len(roots))
+	for _, root := range roots {
+		cleaned = append(cleaned, strings.Trim(filepath.ToSlash(root), "/"))
+	}
+
+	files := map[string][]string{}
+	for _, entry := range entries {
+		for _, p := range entryPaths(entry) {
+			name := longestRoot(cleaned, p)
+			if name == "" {
+				name = otherPartition
+			}
+			files[name] = append(files[name], ":(literal)"+p)
+		}
+	}
+
+	for i := range partitions {
+		partitions[i].Pathspecs = files[partitions[i].Name]
+	}
+	return partitions
+}
+
+func longestRoot(roots []string, file string) string {
+	best := ""
+	for _, root := range roots {
+		if (file == root || strings.HasPrefix(file, root+"/")) && len(root) > len(best) {
+			best = root
+		}
+	}
+	return best
+}
+
+// codeownersRule is one pattern line from a CODEOWNERS file.
+type codeownersRule struct {
+	Pattern string
+	Owners  []string
+}
+
+// partitionByOwners groups changed files by the owners of the last matching
+// CODEOWNERS rule. Files with no owner form an "unowned" partition.
+func partitionByOwners(rules []codeownersRule, entries []statusEntry) []Partition {
+	byOwner := map[string][]string{}
+	for _, entry := range entries {
+		for _, p := range entryPaths(entry) {
+			owner := unownedPartition
+			if owners := ownersFor(rules, p); len(owners) > 0 {
+				owner = strings.Join(owners, " ")
+			}
+			byOwner[owner] = append(byOwner[owner], ":(literal)"+p)
+		}
+	}
+
+	owners := make([]string, 0, len(byOwner))
+	for owner := range byOwner {
+		owners = append(owners, owner)
+	}
+	sort.Strings(owners)
+
+	partitions := make([]Partition, 0, len(owners))
+	for _, owner := range owners {
+		partitions = append(partitions, Partition{Name: owner, Pathspecs: byOwner[owner]})
+	}
+	return partitions
+}
+
+// entryPaths returns the paths a status entry touches; renames touch both.
+func entryPaths(entry statusEntry) []string {
+	if entry.OrigPath != "" {
+		return []string{entry.Path, entry.OrigPath}
+	}
+	return []string{entry.Path}
+}
+
+func loadCodeowners(dir string) ([]codeownersRule, error) {
+	for _, location := range codeownersLocations {
+		f, err := os.Open(filepath.Join(dir, location))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s: %w", location, err)
+		}
+		defer f.Close()
+
+		var rules []codeownersRule
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			fields := strings.Fields(line)
+			rules = append(rules, codeownersRule{Pattern: fields[0], Owners: fields[1:]})
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", location, err)
+		}
+		return rules, nil
+	}
+	return nil, errors.New("no CODEOWNERS file found")
+}
+
+// ownersFor returns the owners of the last rule matching file.
+func ownersFor(rules []codeownersRule, file string) []string {
+	var owners []string
+	for _, rule := range rules {
+		if codeownersMatch(rule.Pattern, file) {
+			owners = rule.Owners
+		}
+	}
+	return owners
+}
+
+// codeownersMatch applies gitignore-style CODEOWNERS semantics: patterns with
+// a leading or inner slash are anchored to the repository root, others match
+// at any depth, and a pattern naming a directory matches its contents. A
+// wildcard in the last segment only matches at that level, so docs/* leaves
+// docs/a/b.md alone.
+func codeownersMatch(pattern, file string) bool {
+	p := pattern
+	if strings.HasSuffix(p, "/") {
+		p += "**"
+	}
+	anchored := strings.HasPrefix(p, "/") || strings.Contains(strings.TrimSuffix(p, "/**"), "/")
+	p = strings.TrimPrefix(p, "/")
+	if !anchored {
+		p = "**/" + p
+	}
+	if matchGlob(p, file) {
+		return true
+	}
+	last := p[strings.LastIndex(p, "/")+1:]
+	return !strings.ContainsAny(last, "*?[") && matchGlob(p+"/**", file)
+}
+
+// sanitizeRefComponent turns a partition or branch name into something
+// usable in a branch name. Names that lose characters get a hash of the
+// original appended, so distinct names never map to the same component and
+// an all-symbol name such as *** is never empty.
+func sanitizeRefComponent(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			b.WriteRune(r)
+		default:
+			b.WriteRune('-')
+		}
+	}
+	component := strings.Trim(b.String(), "-")
+	if component == name {
+		return component
+	}
+	sum := sha256.Sum256([]byte(name))
+	hash := hex.EncodeToString(sum[:4])
+	if component == "" {
+		return hash
+	}
+	return component + "-" + hash
+}
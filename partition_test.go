@@ -0,0 +1,93 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCodeownersMatch(t *testing.T) {
+	tests := []struct {
+		pattern, file string
+		want          bool
+	}{
+		{"*", "a/b/c.go", true},
+		{"*.js", "web/app.js", true},
+		{"*.js", "web/app.ts", false},
+		{"docs/*", "docs/a.md", true},
+		{"docs/*", "docs/a/b.md", false},
+		{"docs/", "docs/a/b.md", true},
+		{"docs/", "src/docs/a.md", true},
+		{"/docs/", "src/docs/a.md", false},
+		{"apps/web", "apps/web/index.ts", true},
+		{"apps/web", "lib/apps/web/index.ts", false},
+		{"/build/logs/", "build/logs/x.log", true},
+		{"**/logs", "deeply/nested/logs/x.log", true},
+		{"docs/**", "docs/a/b.md", true},
+		{"/README.md", "README.md", true},
+		{"/README.md", "docs/README.md", false},
+		{"README.md", "docs/README.md", true},
+	}
+	for _, tt := range tests {
+		if got := codeownersMatch(tt.pattern, tt.file); got != tt.want {
+			t.Errorf("codeownersMatch(%q, %q) = %v, want %v", tt.pattern, tt.file, got, tt.want)
+		}
+	}
+}
+
+func TestOwnersForUsesLastMatch(t *testing.T) {
+	rules := []codeownersRule{
+		{Pattern: "*", Owners: []string{"@org/all"}},
+		{Pattern: "docs/*", Owners: []string{"@org/docs"}},
+	}
+	tests := map[string][]string{
+		"main.go":     {"@org/all"},
+		"docs/a.md":   {"@org/docs"},
+		"docs/a/b.md": {"@org/all"},
+	}
+	for file, want := range tests {
+		if got := ownersFor(rules, file); !reflect.DeepEqual(got, want) {
+			t.Errorf("ownersFor(%q) = %q, want %q", file, got, want)
+		}
+	}
+}
+
+func TestSanitizeRefComponent(t *testing.T) {
+	tests := []struct {
+		name, wantPrefix string
+		hashed           bool
+	}{
+		{name: "web", wantPrefix: "web"},
+		{name: "team_a-1", wantPrefix: "team_a-1"},
+		{name: "@org/web", wantPrefix: "org-web-", hashed: true},
+		{name: "release/1.0", wantPrefix: "release-1-0-", hashed: true},
+		{name: "***", wantPrefix: "", hashed: true},
+	}
+	for _, tt := range tests {
+		got := sanitizeRefComponent(tt.name)
+		if !strings.HasPrefix(got, tt.wantPrefix) {
+			t.Errorf("sanitizeRefComponent(%q) = %q, want prefix %q", tt.name, got, tt.wantPrefix)
+		}
+		if tt.hashed && len(got) != len(tt.wantPrefix)+8 {
+			t.Errorf("sanitizeRefComponent(%q) = %q, want an 8-character hash suffix", tt.name, got)
+		}
+		if !tt.hashed && got != tt.name {
+			t.Errorf("sanitizeRefComponent(%q) = %q, want it unchanged", tt.name, got)
+		}
+	}
+}
+
+func TestSanitizeRefComponentDistinct(t *testing.T) {
+	names := []string{"@org/a-b", "@org/a.b", "org-a-b", "***", "+++", ""}
+	seen := map[string]string{}
+	for _, name := range names {
+		got := sanitizeRefComponent(name)
+		if name != "" && got == "" {
+			t.Errorf("sanitizeRefComponent(%q) is empty", name)
+		}
+		if other, ok := seen[got]; ok {
+			t.Errorf("sanitizeRefComponent(%q) and (%q) both = %q", name, other, got)
+		}
+		seen[got] = name
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// Preflight checks that the token and the repository's settings allow the
+// configured flow, so a run fails before the commands rather than at push
+// or merge time.
+func Preflight(cfg config, client *GitHubClient) error {
+	fullName := cfg.RepoOwner + "/" + cfg.RepoName
+
+	user, err := client.GetAuthenticatedUser()
+	switch {
+	case isAPIStatus(err, http.StatusUnauthorized):
+		return errors.New("github_access_token was rejected by GitHub; check that it is valid and has not expired")
+	case err != nil:
+		// GitHub App installation tokens, including GITHUB_TOKEN, can't read /user.
+		log.Printf("Could not resolve the token's user (%v); continuing.\n", err)
+	default:
+		log.Printf("Authenticated as %s.\n", user.Login)
+	}
+
+	repo, err := client.GetRepository()
+	if isAPIStatus(err, http.StatusNotFound) {
+		return fmt.Errorf("repository %s was not found; check that github_access_token can read it", fullName)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to fetch repository %s: %w", fullName, err)
+	}
+	if repo.Archived {
+		return fmt.Errorf("%s is archived and read-only; unarchive it or stop running the action on it", fullName)
+	}
+
+	// Permissions are missing from the response for some token types, in
+	// which case every flag is false and the push check is skipped.
+	reported := repo.Permissions.Admin || repo.Permissions.Push || repo.Permissions.Pull
+	if reported && !repo.Permissions.Push && cfg.SSHCommand == "" && !pushesToFork(cfg) {
+		return fmt.Errorf("github_access_token cannot push to %s; grant it write access to contents (`permissions: contents: write` for GITHUB_TOKEN), or push with ssh_key or push_remote", fullName)
+	}
+
+	if mergesPullRequests(cfg) {
+		method, allowed := "squash", repo.AllowSquashMerge
+		if cfg.Mode == "merge" {
+			method, allowed = "merge commit", repo.AllowMergeCommit
+		}
+		// The merge settings are only returned to users who can push; at
+		// least one method is always enabled when they are.
+		settingsReported := repo.AllowSquashMerge || repo.AllowMergeCommit || repo.AllowRebaseMerge
+		if settingsReported && !allowed {
+			return fmt.Errorf("%s does not allow %s merges, which the action uses to merge its PRs; enable them under Settings > General > Pull Requests", fullName, method)
+		}
+	}
+
+	return checkBranchProtection(cfg, client, repo.Permissions.Admin)
+}
+
+// mergesPullRequests reports whether the configured flow merges PRs itself.
+func mergesPullRequests(cfg config) bool {
+	if pushesToFork(cfg) || cfg.CommitToPR {
+		return false
+	}
+	switch cfg.Mode {
+	case "merge":
+		return cfg.MergePush == "pr"
+	case "update-prs":
+		return false
+	}
+	return true
+}
+
+// pushesDirectly reports whether the configured flow pushes to the target
+// branches themselves.
+func pushesDirectly(cfg config) bool {
+	switch cfg.Mode {
+	case "merge":
+		return cfg.MergePush == "direct"
+	case "commands":
+		return cfg.DirectPush
+	}
+	return false
+}
+
+// branchRequirements is what protection on a branch demands of the action,
+// after the token's bypasses.
+type branchRequirements struct {
+	Reviews       int      // approving reviews needed to merge a PR
+	LinearHistory bool     // merge commits are rejected
+	PushBlockers  []string // why a direct push would be rejected
+	Unknown       bool     // protected, but the protection could not be read
+}
+
+// checkBranchProtection fails when protection on a target branch would
+// reject the configured flow: required reviews block the action's own
+// merges, linear history blocks merge mode, and most rules block direct
+// pushes. Commands mode only warns about the latter since it falls back to
+// a PR.
+func checkBranchProtection(cfg config, client *GitHubClient, admin bool) error {
+	prFlow, directFlow := mergesPullRequests(cfg), pushesDirectly(cfg)
+	if !prFlow && !directFlow {
+		return nil
+	}
+
+	var targets []string
+	var err error
+	if cfg.Mode == "merge" {
+		targets, err = ResolveMergeTargets(cfg, client)
+	} else {
+		targets, err = ResolveBaseBranches(cfg, client)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, target := range targets {
+		req, err := readBranchRequirements(client, target, admin)
+		if err != nil {
+			return err
+		}
+		if req.Unknown {
+			notice(fmt.Sprintf("Could not read the protection of %s, which needs admin access; required reviews or checks there may still block the action.", target))
+		}
+		if cfg.Mode == "merge" && req.LinearHistory {
+			return fmt.Errorf("%s requires linear history, which rejects merge mode's merge commits; let the token bypass the rule or turn it off", target)
+		}
+		if directFlow && len(req.PushBlockers) > 0 {
+			reasons := strings.Join(req.PushBlockers, " and ")
+			if cfg.Mode == "merge" {
+				return fmt.Errorf("merge_push is direct but %s %s, which rejects the push; use merge_push: pr, or let the token bypass the protection", target, reasons)
+			}
+			notice(fmt.Sprintf("%s %s; direct pushes there will fall back to a pull request.", target, reasons))
+		}
+		if prFlow && req.Reviews > 0 {
+			return fmt.Errorf("%s requires %d approving review(s), which the action can't give its own PRs, so the merge would be rejected; let the token bypass the requirement or lower it", target, req.Reviews)
+		}
+	}
+	return nil
+}
+
+// readBranchRequirements combines the classic protection and the rulesets
+// of branch, leaving out rules the token may bypass. Classic protection is
+// bypassed by admins unless it is enforced for them.
+func readBranchRequirements(client *GitHubClient, branch string, admin bool) (branchRequirements, error) {
+	var req branchRequirements
+
+	protection, err := client.GetBranchProtection(branch)
+	var apiErr *APIError
+	switch {
+	case err == nil:
+		if !admin || protection.EnforceAdmins.Enabled {
+			req.addClassic(protection)
+		}
+	case errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound && strings.Contains(apiErr.Body, "Branch not protected"):
+	case isAPIStatus(err, http.StatusNotFound) || isAPIStatus(err, http.StatusForbidden):
+		info, err := client.GetBranch(branch)
+		if err != nil {
+			return req, fmt.Errorf("failed to fetch branch %s: %w", branch, err)
+		}
+		req.Unknown = info.Protected
+	default:
+		return req, fmt.Errorf("failed to read protection of %s: %w", branch, err)
+	}
+
+	rules, err := client.ListBranchRules(branch)
+	if isAPIStatus(err, http.StatusNotFound) || isAPIStatus(err, http.StatusForbidden) {
+		log.Printf("Could not read the rulesets of %s (%v); continuing.\n", branch, err)
+		return req, nil
+	}
+	if err != nil {
+		return req, fmt.Errorf("failed to list rules for %s: %w", branch, err)
+	}
+	bypass := map[int64]string{}
+	for _, rule := range rules {
+		mode, ok := bypass[rule.RulesetID]
+		if !ok {
+			// An unreadable ruleset is assumed to apply.
+			if ruleset, err := client.GetRuleset(rule.RulesetID); err == nil {
+				mode = ruleset.CurrentUserCanBypass
+			}
+			bypass[rule.RulesetID] = mode
+		}
+		if mode == "always" {
+			continue
+		}
+		req.addRule(rule, mode == "pull_requests_only")
+	}
+	return req, nil
+}
+
+func (r *branchRequirements) addClassic(p *BranchProtection) {
+	if p.RequiredPullRequestReviews != nil {
+		r.Reviews = max(r.Reviews, p.RequiredPullRequestReviews.RequiredApprovingReviewCount)
+		r.block("requires pull requests")
+	}
+	if p.RequiredStatusChecks != nil {
+		r.block("requires status checks")
+	}
+	if p.RequiredSignatures.Enabled {
+		r.block("requires signed commits")
+	}
+	r.LinearHistory = r.LinearHistory || p.RequiredLinearHistory.Enabled
+}
+
+func (r *branchRequirements) block(reason string) {
+	if !containsFold(r.PushBlockers, reason) {
+		r.PushBlockers = append(r.PushBlockers, reason)
+	}
+}
+
+// addRule applies a ruleset rule. prBypass means the token may bypass the
+// ruleset when merging PRs, but not when pushing.
+func (r *branchRequirements) addRule(rule BranchRule, prBypass bool) {
+	switch rule.Type {
+	case "pull_request":
+		var params RequiredReviews
+		if err := json.Unmarshal(rule.Parameters, &params); err == nil && !prBypass {
+			r.Reviews = max(r.Reviews, params.RequiredApprovingReviewCount)
+		}
+		r.block("requires pull requests")
+	case "required_status_checks":
+		r.block("requires status checks")
+	case "required_signatures":
+		r.block("requires signed commits")
+	case "update":
+		r.block("restricts updates")
+	case "required_linear_history":
+		r.LinearHistory = true
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestMergesPullRequests(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config
+		want bool
+	}{
+		{name: "commands", cfg: config{Mode: "commands"}, want: true},
+		{name: "direct push falls back to a PR", cfg: config{Mode: "commands", DirectPush: true}, want: true},
+		{name: "commit to pull request", cfg: config{Mode: "commands", CommitToPR: true}, want: false},
+		{name: "merge via PR", cfg: config{Mode: "merge", MergePush: "pr"}, want: true},
+		{name: "merge pushed directly", cfg: config{Mode: "merge", MergePush: "direct"}, want: false},
+		{name: "update-prs", cfg: config{Mode: "update-prs"}, want: false},
+		{
+			name: "fork",
+			cfg:  config{Mode: "commands", RepoOwner: "org", RepoName: "repo", PushOwner: "bot", PushRepo: "repo"},
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mergesPullRequests(tt.cfg); got != tt.want {
+				t.Errorf("mergesPullRequests() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBranchRequirements(t *testing.T) {
+	reviews := json.RawMessage(`{"required_approving_review_count": 2}`)
+	tests := []struct {
+		name     string
+		classic  *BranchProtection
+		rules    []BranchRule
+		prBypass bool
+		want     branchRequirements
+	}{
+		{name: "unprotected", want: branchRequirements{}},
+		{
+			name:    "classic reviews and checks",
+			classic: &BranchProtection{RequiredPullRequestReviews: &RequiredReviews{RequiredApprovingReviewCount: 1}, RequiredStatusChecks: &struct{}{}},
+			want:    branchRequirements{Reviews: 1, PushBlockers: []string{"requires pull requests", "requires status checks"}},
+		},
+		{
+			name:    "classic linear history",
+			classic: &BranchProtection{RequiredLinearHistory: ProtectionSetting{Enabled: true}},
+			want:    branchRequirements{LinearHistory: true},
+		},
+		{
+			name:    "ruleset duplicates classic",
+			classic: &BranchProtection{RequiredPullRequestReviews: &RequiredReviews{}},
+			rules:   []BranchRule{{Type: "pull_request", Parameters: reviews}, {Type: "update"}},
+			want:    branchRequirements{Reviews: 2, PushBlockers: []string{"requires pull requests", "restricts updates"}},
+		},
+		{
+			name:     "ruleset bypassed for pull requests",
+			rules:    []BranchRule{{Type: "pull_request", Parameters: reviews}},
+			prBypass: true,
+			want:     branchRequirements{PushBlockers: []string{"requires pull requests"}},
+		},
+		{
+			name:  "unrelated rules",
+			rules: []BranchRule{{Type: "deletion"}, {Type: "non_fast_forward"}},
+			want:  branchRequirements{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got branchRequirements
+			if tt.classic != nil {
+				got.addClassic(tt.classic)
+			}
+			for _, rule := range tt.rules {
+				got.addRule(rule, tt.prBypass)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("requirements = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// changesCommentMarker tags comments suggesting changes, so each PR head
+// commit is commented on at most once.
+const changesCommentMarker = "<!-- merge-from-main:changes %s -->"
+
+// CommitToPullRequest runs the commands on the head of the triggering PR and
+// pushes any changes to its branch instead of opening a PR of its own. When
+// the branch can't be pushed to, the PR gets a comment listing the changes.
+func CommitToPullRequest(cfg config, client *GitHubClient, pr *PullRequest) []TargetResult {
+	result := TargetResult{Repository: cfg.RepoOwner + "/" + cfg.RepoName, Branch: pr.Head.Ref, PR: pr}
+	failed := func(stage string, err error) []TargetResult {
+		result.Outcome = OutcomeFailed
+		result.Err = &StageError{Stage: stage, Err: err}
+		return []TargetResult{result}
+	}
+
+	// Fork branches are only reachable through pull/<n>/head, which GitHub
+	// updates asynchronously; same-repository PRs use the branch itself.
+	checkoutCfg := cfg
+	checkoutCfg.BaseBranch = pr.Head.Ref
+	if !isSameRepository(cfg, pr) {
+		checkoutCfg.BaseBranch = fmt.Sprintf("pull/%d/head", pr.Number)
+	}
+	var headSHA string
+	err := runStage("checkout", fmt.Sprintf("Check out PR #%d", pr.Number), func() error {
+		var err error
+		headSHA, err = checkoutLatestBase(checkoutCfg)
+		return err
+	}, "pr", pr.Number)
+	if err != nil {
+		return failed("checkout", err)
+	}
+
+	shouldRun, err := ConfirmShouldRun(cfg)
+	if err != nil {
+		return failed("confirm", err)
+	}
+	if !shouldRun {
+		notice(fmt.Sprintf("Head of PR #%d uses an ignore prefix. Exiting without action.", pr.Number))
+		result.Outcome = OutcomeSkipped
+		return []TargetResult{result}
+	}
+
+	cfg.BaseBranch = pr.Base.Ref
+	cfg.BaseSHA = headSHA
+	cfg.WorkBranch = pr.Head.Ref
+	if err := RunCommands(cfg); err != nil {
+		return failed("commands", err)
+	}
+
+	if cfg.Strict {
+		if err := CheckStrict(cfg); err != nil {
+			return failed("strict", err)
+		}
+	}
+
+	entries, err := gitStatus(cfg.WorkDir, cfg.StagePaths...)
+	if err != nil {
+		return failed("changes", err)
+	}
+	if len(entries) == 0 {
+		notice(fmt.Sprintf("No changes detected on PR #%d after running commands. Nothing to commit.", pr.Number))
+		result.Outcome = OutcomeNoChanges
+		return []TargetResult{result}
+	}
+
+	safeguardErr, err := CheckSafeguards(cfg)
+	if err != nil {
+		return failed("safeguards", err)
+	}
+	if safeguardErr != nil && cfg.SafeguardAction == "fail" {
+		return failed("safeguards", safeguardErr)
+	}
+
+	if !isSameRepository(cfg, pr) {
+		reason := fmt.Sprintf("this PR comes from %s, which the action cannot push to", firstNonEmpty(pr.Head.Repo.FullName, "a deleted fork"))
+		if err := suggestChanges(cfg, client, pr, reason, entries); err != nil {
+			return failed("comment", err)
+		}
+		notice(fmt.Sprintf("PR #%d is from a fork; commented with the changes instead of pushing.", pr.Number))
+		result.Outcome = OutcomeSkipped
+		return []TargetResult{result}
+	}
+
+	err = runStage("commit", fmt.Sprintf("Push changes to PR #%d", pr.Number), func() error {
+		if err := stageAndCommit(cfg, cfg.CommitPrefix+" Apply automated changes"); err != nil {
+			return err
+		}
+		return pushToOrigin(cfg, "HEAD:refs/heads/"+pr.Head.Ref)
+	}, "pr", pr.Number, "branch", pr.Head.Ref)
+	if err != nil {
+		if commentErr := suggestChanges(cfg, client, pr, "pushing them to `"+pr.Head.Ref+"` failed", entries); commentErr != nil {
+			return failed("commit", fmt.Errorf("%w (and %v)", err, commentErr))
+		}
+		return failed("commit", err)
+	}
+
+	if safeguardErr != nil {
+		if err := client.CreateComment(pr.Number, redact(safeguardErr.Markdown())); err != nil {
+			return failed("comment", fmt.Errorf("failed to comment on PR #%d: %w", pr.Number, err))
+		}
+	}
+	notice(fmt.Sprintf("Pushed changes to PR #%d.", pr.Number))
+	result.Outcome = OutcomeUpdated
+	return []TargetResult{result}
+}
+
+// suggestChanges comments the files the commands changed, and how to
+// reproduce them, on a PR the changes could not be pushed to.
+func suggestChanges(cfg config, client *GitHubClient, pr *PullRequest, reason string, entries []statusEntry) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "The automated commands change these files, but %s:\n\n", reason)
+	for _, e := range entries {
+		fmt.Fprintf(&b, "- `%s`\n", e.Path)
+	}
+	fmt.Fprintf(&b, "\nRun them locally and push the result:\n\n```sh\n%s\n```\n", strings.Join(cfg.Commands, "\n"))
+	return commentOnce(client, pr, changesCommentMarker, pr.Head.Sha, redact(b.String()))
+}
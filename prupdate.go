@@ -0,0 +1,211 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// conflictCommentMarker tags conflict comments so each PR head commit is
+// commented on at most once.
+const conflictCommentMarker = "<!-- merge-from-main:conflicts %s -->"
+
+// UpdatePullRequests brings every open PR targeting cfg.BaseBranch that
+// passes the configured filters up to date with it, producing one result
+// per PR.
+func UpdatePullRequests(cfg config, client *GitHubClient) []TargetResult {
+	repository := cfg.RepoOwner + "/" + cfg.RepoName
+	var prs []PullRequest
+	err := runStage("list", "List pull requests targeting "+cfg.BaseBranch, func() error {
+		var err error
+		prs, err = client.ListOpenPullRequests(cfg.BaseBranch)
+		return err
+	}, "branch", cfg.BaseBranch)
+	if err != nil {
+		return []TargetResult{{
+			Repository: repository,
+			Branch:     cfg.BaseBranch,
+			Outcome:    OutcomeFailed,
+			Err:        &StageError{Stage: "list", Err: fmt.Errorf("failed to list pull requests: %w", err)},
+		}}
+	}
+
+	var results []TargetResult
+	for i := range prs {
+		pr := &prs[i]
+		if reason := skipPullRequest(cfg, pr); reason != "" {
+			log.Printf("Skipping PR #%d: %s.\n", pr.Number, reason)
+			continue
+		}
+
+		result := TargetResult{Repository: repository, Branch: pr.Head.Ref, PR: pr}
+		err := runStage("update", fmt.Sprintf("Update PR #%d", pr.Number), func() error {
+			var err error
+			result.Outcome, err = syncPullRequest(cfg, client, pr)
+			return err
+		}, "pr", pr.Number, "sha", pr.Head.Sha)
+		if err != nil {
+			result.Outcome = OutcomeFailed
+			result.Err = &StageError{Stage: "update", Err: err}
+		}
+		results = append(results, result)
+	}
+
+	if len(results) == 0 {
+		notice(fmt.Sprintf("No open pull requests to update against %s.", cfg.BaseBranch))
+		return []TargetResult{{Repository: repository, Branch: cfg.BaseBranch, Outcome: OutcomeNoChanges}}
+	}
+	return results
+}
+
+// skipPullRequest returns why pr is left alone, or "" to update it.
+func skipPullRequest(cfg config, pr *PullRequest) string {
+	if strings.HasPrefix(pr.Head.Ref, "auto-merge-") && isSameRepository(cfg, pr) {
+		return "opened by this action"
+	}
+	switch {
+	case cfg.UpdatePRsDrafts == "exclude" && pr.Draft:
+		return "draft"
+	case cfg.UpdatePRsDrafts == "only" && !pr.Draft:
+		return "not a draft"
+	}
+	if len(cfg.UpdatePRsLabels) > 0 && !hasAnyLabel(pr, cfg.UpdatePRsLabels) {
+		return "no matching label"
+	}
+	if len(cfg.UpdatePRsAuthors) > 0 && !containsFold(cfg.UpdatePRsAuthors, pr.User.Login) {
+		return "author " + pr.User.Login + " not selected"
+	}
+	return ""
+}
+
+// syncPullRequest merges the base branch into the PR head, through the
+// update-branch API or a local merge, and returns the outcome.
+func syncPullRequest(cfg config, client *GitHubClient, pr *PullRequest) (string, error) {
+	comparison, err := client.CompareCommits(cfg.BaseBranch, pr.Head.Sha)
+	if err != nil {
+		return "", fmt.Errorf("failed to compare PR #%d with %s: %w", pr.Number, cfg.BaseBranch, err)
+	}
+	if comparison.BehindBy == 0 {
+		log.Printf("PR #%d already contains %s.\n", pr.Number, cfg.BaseBranch)
+		return OutcomeUpToDate, nil
+	}
+
+	if cfg.UpdatePRsMethod == "merge" {
+		return mergeIntoPullRequest(cfg, client, pr)
+	}
+
+	err = client.UpdatePullRequestBranch(pr.Number, pr.Head.Sha)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == 422 && strings.Contains(strings.ToLower(apiErr.Body), "conflict") {
+		return OutcomeConflicts, commentConflicts(cfg, client, pr, nil)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to update PR #%d: %w", pr.Number, err)
+	}
+	log.Printf("Updated PR #%d with %s.\n", pr.Number, cfg.BaseBranch)
+	return OutcomeUpdated, nil
+}
+
+// mergeIntoPullRequest merges the base branch into the PR head locally and
+// pushes the result. Only branches in this repository can be pushed to.
+func mergeIntoPullRequest(cfg config, client *GitHubClient, pr *PullRequest) (string, error) {
+	if !isSameRepository(cfg, pr) {
+		log.Printf("PR #%d comes from %s; local merges can only push to %s/%s.\n", pr.Number, pr.Head.Repo.FullName, cfg.RepoOwner, cfg.RepoName)
+		return OutcomeSkipped, nil
+	}
+
+	prCfg := cfg
+	prCfg.MergeSource = cfg.BaseBranch
+	prCfg.BaseBranch = pr.Head.Ref
+	sourceSHA, err := fetchMergeSource(prCfg)
+	if err != nil {
+		return "", err
+	}
+	if _, err := checkoutLatestBase(prCfg); err != nil {
+		return "", err
+	}
+
+	resolved, conflicts, err := mergeSource(prCfg, sourceSHA)
+	if err != nil {
+		return "", err
+	}
+	if len(conflicts) > 0 {
+		if err := runGit(cfg.WorkDir, "merge", "--abort"); err != nil {
+			return "", fmt.Errorf("failed to abort merge: %w", err)
+		}
+		return OutcomeConflicts, commentConflicts(cfg, client, pr, conflicts)
+	}
+	for _, r := range resolved {
+		log.Printf("Resolved conflict in %s: %s.\n", r.Path, r.Strategy.Label())
+	}
+
+	if err := pushToOrigin(prCfg, "HEAD:refs/heads/"+pr.Head.Ref); err != nil {
+		return "", err
+	}
+	log.Printf("Merged %s into PR #%d.\n", cfg.BaseBranch, pr.Number)
+	return OutcomeUpdated, nil
+}
+
+// commentConflicts tells the PR author that the branch needs a manual merge,
+// once per head commit. files may be nil when the conflicts are unknown.
+func commentConflicts(cfg config, client *GitHubClient, pr *PullRequest, files []string) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "This branch conflicts with `%s` and could not be updated automatically.\n", cfg.BaseBranch)
+	if len(files) > 0 {
+		b.WriteString("\nConflicting files:\n\n")
+		for _, f := range files {
+			fmt.Fprintf(&b, "- `%s`\n", f)
+		}
+	}
+	fmt.Fprintf(&b, "\nMerge `%s` into this branch and resolve the conflicts.\n", cfg.BaseBranch)
+	log.Printf("PR #%d conflicts with %s.\n", pr.Number, cfg.BaseBranch)
+	return commentOnce(client, pr, conflictCommentMarker, pr.Head.Sha, b.String())
+}
+
+// commentOnce comments body on pr unless the PR description or a comment is
+// already tagged with the marker for key, usually the PR's head commit.
+// markerFormat takes the key.
+func commentOnce(client *GitHubClient, pr *PullRequest, markerFormat, key, body string) error {
+	marker := fmt.Sprintf(markerFormat, key)
+	if strings.Contains(pr.Body, marker) {
+		log.Printf("PR #%d already reports %s.\n", pr.Number, key)
+		return nil
+	}
+	comments, err := client.ListComments(pr.Number)
+	if err != nil {
+		return fmt.Errorf("failed to list comments on PR #%d: %w", pr.Number, err)
+	}
+	for _, c := range comments {
+		if strings.Contains(c.Body, marker) {
+			log.Printf("Already commented on PR #%d for %s.\n", pr.Number, key)
+			return nil
+		}
+	}
+	if err := client.CreateComment(pr.Number, body+"\n"+marker+"\n"); err != nil {
+		return fmt.Errorf("failed to comment on PR #%d: %w", pr.Number, err)
+	}
+	return nil
+}
+
+func isSameRepository(cfg config, pr *PullRequest) bool {
+	return strings.EqualFold(pr.Head.Repo.FullName, cfg.RepoOwner+"/"+cfg.RepoName)
+}
+
+func hasAnyLabel(pr *PullRequest, names []string) bool {
+	for _, label := range pr.Labels {
+		if containsFold(names, label.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(values []string, s string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,50 @@
+package main
+
+import "testing"
+
+func TestSkipPullRequest(t *testing.T) {
+	own := func(ref string) PullRequest {
+		var pr PullRequest
+		pr.Head.Ref = ref
+		pr.Head.Repo.FullName = "org/repo"
+		pr.User.Login = "alice"
+		return pr
+	}
+	draft := own("feature")
+	draft.Draft = true
+	labelled := own("feature")
+	labelled.Labels = []Label{{Name: "Sync"}}
+	fromFork := own("auto-merge-1")
+	fromFork.Head.Repo.FullName = "someone/repo"
+
+	base := config{RepoOwner: "org", RepoName: "repo", UpdatePRsDrafts: "include"}
+	with := func(f func(*config)) config {
+		cfg := base
+		f(&cfg)
+		return cfg
+	}
+	tests := []struct {
+		name string
+		cfg  config
+		pr   PullRequest
+		skip bool
+	}{
+		{name: "plain PR", cfg: base, pr: own("feature")},
+		{name: "own branch", cfg: base, pr: own("auto-merge-1"), skip: true},
+		{name: "fork branch with the same name", cfg: base, pr: fromFork},
+		{name: "draft excluded", cfg: with(func(c *config) { c.UpdatePRsDrafts = "exclude" }), pr: draft, skip: true},
+		{name: "only drafts", cfg: with(func(c *config) { c.UpdatePRsDrafts = "only" }), pr: own("feature"), skip: true},
+		{name: "label matches", cfg: with(func(c *config) { c.UpdatePRsLabels = []string{"sync"} }), pr: labelled},
+		{name: "label missing", cfg: with(func(c *config) { c.UpdatePRsLabels = []string{"sync"} }), pr: own("feature"), skip: true},
+		{name: "author matches", cfg: with(func(c *config) { c.UpdatePRsAuthors = []string{"Alice"} }), pr: own("feature")},
+		{name: "author not selected", cfg: with(func(c *config) { c.UpdatePRsAuthors = []string{"bob"} }), pr: own("feature"), skip: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reason := skipPullRequest(tt.cfg, &tt.pr)
+			if (reason != "") != tt.skip {
+				t.Errorf("skipPullRequest() = %q, want skip %v", reason, tt.skip)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	neturl "net/url"
+	"os"
+	"strings"
+	"sync"
+)
+
+const redactedPlaceholder = "***"
+
+var (
+	secretsMu sync.RWMutex
+	secrets   []string
+)
+
+// registerSecrets masks the access token and the values of every
+// environment variable in cfg.MaskEnv.
+func registerSecrets(cfg config) {
+	registerSecret(cfg.AccessToken)
+	addMask(gitBasicCredentials(cfg.AccessToken))
+	registerSecret(cfg.SSHKey)
+	for _, name := range cfg.MaskEnv {
+		registerSecret(os.Getenv(name))
+	}
+	if u, err := neturl.Parse(cfg.PushRemote); err == nil && u.User != nil {
+		if password, ok := u.User.Password(); ok {
+			registerSecret(password)
+		}
+	}
+}
+
+// addMask registers a secret derived at runtime and tells the Actions runner
+// to mask it too, since the runner only knows about secrets passed in.
+func addMask(secret string) {
+	registerSecret(secret)
+	if !inActions() {
+		return
+	}
+	for _, line := range secretLines(secret) {
+		fmt.Fprintf(os.Stdout, "::add-mask::%s\n", line)
+	}
+}
+
+// registerSecret adds a value that must never appear in output. Multi-line
+// values are also registered line by line because output is redacted a line
+// at a time.
+func registerSecret(secret string) {
+	if strings.TrimSpace(secret) == "" {
+		return
+	}
+	for _, line := range secretLines(secret) {
+		if line != secret {
+			registerSecret(line)
+		}
+	}
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+	for _, s := range secrets {
+		if s == secret {
+			return
+		}
+	}
+	secrets = append(secrets, secret)
+}
+
+func secretLines(secret string) []string {
+	var lines []string
+	for _, line := range strings.Split(secret, "\n") {
+		if line = strings.TrimSpace(line); len(line) >= 8 {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// isSecret reports whether value is exactly a registered secret.
+func isSecret(value string) bool {
+	if value == "" {
+		return false
+	}
+	secretsMu.RLock()
+	defer secretsMu.RUnlock()
+	for _, secret := range secrets {
+		if secret == value {
+			return true
+		}
+	}
+	return false
+}
+
+// redact replaces every registered secret in s.
+func redact(s string) string {
+	secretsMu.RLock()
+	defer secretsMu.RUnlock()
+	for _, secret := range secrets {
+		s = strings.ReplaceAll(s, secret, redactedPlaceholder)
+	}
+	return s
+}
+
+// redactingWriter masks registered secrets before writing to w. Output is
+// buffered per line so a secret split across writes is still caught; call
+// Flush once the producer is done.
+type redactingWriter struct {
+	mu  sync.Mutex
+	w   io.Writer
+	buf []byte
+}
+
+func newRedactingWriter(w io.Writer) *redactingWriter {
+	return &redactingWriter{w: w}
+}
+
+func (r *redactingWriter) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.buf = append(r.buf, p...)
+	i := bytes.LastIndexByte(r.buf, '\n')
+	if i < 0 {
+		return len(p), nil
+	}
+	if _, err := io.WriteString(r.w, redact(string(r.buf[:i+1]))); err != nil {
+		return 0, err
+	}
+	r.buf = append(r.buf[:0], r.buf[i+1:]...)
+	return len(p), nil
+}
+
+// Flush writes any buffered partial line.
+func (r *redactingWriter) Flush() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.buf) == 0 {
+		return nil
+	}
+	_, err := io.WriteString(r.w, redact(string(r.buf)))
+	r.buf = r.buf[:0]
+	return err
+}
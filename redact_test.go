@@ -0,0 +1,74 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// withSecrets registers values for the duration of a test.
+func withSecrets(t *testing.T, values ...string) {
+	t.Helper()
+	secretsMu.Lock()
+	saved := secrets
+	secrets = nil
+	secretsMu.Unlock()
+	t.Cleanup(func() {
+		secretsMu.Lock()
+		secrets = saved
+		secretsMu.Unlock()
+	})
+	for _, v := range values {
+		registerSecret(v)
+	}
+}
+
+func TestRedact(t *testing.T) {
+	withSecrets(t, "ghp_supersecret", "-----BEGIN KEY-----\nline-one-of-key\nshort\n-----END KEY-----", "  ")
+
+	tests := []struct {
+		in, want string
+	}{
+		{"token ghp_supersecret used", "token *** used"},
+		{"ghp_supersecretghp_supersecret", "******"},
+		{"key line: line-one-of-key", "key line: ***"},
+		{"short stays", "short stays"},
+		{"nothing secret", "nothing secret"},
+	}
+	for _, tt := range tests {
+		if got := redact(tt.in); got != tt.want {
+			t.Errorf("redact(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRedactingWriter(t *testing.T) {
+	withSecrets(t, "ghp_supersecret")
+
+	tests := []struct {
+		name   string
+		writes []string
+		want   string
+	}{
+		{name: "single write", writes: []string{"a ghp_supersecret b\n"}, want: "a *** b\n"},
+		{name: "secret split across writes", writes: []string{"a ghp_sup", "ersecret b\n"}, want: "a *** b\n"},
+		{name: "partial line flushed", writes: []string{"first\nlast ghp_supersecret"}, want: "first\nlast ***"},
+		{name: "several lines", writes: []string{"x\nghp_supersecret\ny\n"}, want: "x\n***\ny\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			w := newRedactingWriter(&out)
+			for _, s := range tt.writes {
+				if n, err := w.Write([]byte(s)); err != nil || n != len(s) {
+					t.Fatalf("Write(%q) = %d, %v", s, n, err)
+				}
+			}
+			if err := w.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			if got := out.String(); got != tt.want {
+				t.Errorf("output = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
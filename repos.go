@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+// RunRepositories clones each of cfg.Repositories into a temporary directory
+// and runs the full pipeline there, at most cfg.MaxParallel at a time.
+func RunRepositories(cfg config) []TargetResult {
+	parallel := cfg.MaxParallel
+	if parallel <= 0 {
+		parallel = 1
+	}
+	sem := make(chan struct{}, parallel)
+	if parallel > 1 {
+		groupsEnabled = false
+	}
+
+	perRepo := make([][]TargetResult, len(cfg.Repositories))
+	var wg sync.WaitGroup
+	for i, fullName := range cfg.Repositories {
+		wg.Add(1)
+		go func(i int, fullName string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			perRepo[i] = runClonedRepository(cfg, fullName)
+		}(i, fullName)
+	}
+	wg.Wait()
+
+	var results []TargetResult
+	for _, r := range perRepo {
+		results = append(results, r...)
+	}
+	return results
+}
+
+func runClonedRepository(cfg config, fullName string) []TargetResult {
+	owner, name, _ := strings.Cut(fullName, "/")
+	client := NewGitHubClient(cfg.AccessToken, owner, name)
+
+	repoCfg := cfg
+	repoCfg.RepoOwner = owner
+	repoCfg.RepoName = name
+	repoCfg.Repositories = nil
+
+	failed := func(stage string, err error) []TargetResult {
+		stageErr := &StageError{Stage: stage, Err: fmt.Errorf("%s: %w", fullName, err)}
+		annotateError(stageErr)
+		return []TargetResult{{
+			Repository: fullName,
+			Outcome:    OutcomeFailed,
+			Err:        stageErr,
+		}}
+	}
+
+	repo, err := client.GetRepository()
+	if err != nil {
+		return failed("clone", fmt.Errorf("failed to fetch repository: %w", err))
+	}
+	repoCfg.BaseBranch = repo.DefaultBranch
+
+	dir, err := os.MkdirTemp("", "merge-from-main-*")
+	if err != nil {
+		return failed("clone", err)
+	}
+	defer os.RemoveAll(dir)
+
+	log.Printf("Cloning %s into %s...\n", fullName, dir)
+	if err := runGitRemote(repoCfg, "", "clone", repoURL(repoCfg), dir); err != nil {
+		return failed("clone", fmt.Errorf("failed to clone %s: %w", fullName, err))
+	}
+	repoCfg.WorkDir = dir
+
+	results := runRepository(repoCfg, client)
+	log.Printf("Finished %s.\n", fullName)
+	return results
+}
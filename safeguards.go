@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// SafeguardError lists every limit the pending changes violate.
+type SafeguardError struct {
+	Violations []string
+}
+
+func (e *SafeguardError) Error() string {
+	return "changes violate safeguards:\n  - " + strings.Join(e.Violations, "\n  - ")
+}
+
+// Markdown renders the violations for a PR comment.
+func (e *SafeguardError) Markdown() string {
+	var b strings.Builder
+	b.WriteString("This PR was opened but not merged because the changes violate the configured safeguards:\n\n")
+	for _, v := range e.Violations {
+		fmt.Fprintf(&b, "- %s\n", v)
+	}
+	return b.String()
+}
+
+// CheckSafeguards compares the pending changes against the configured file,
+// line and path limits. It returns nil when nothing is violated.
+func CheckSafeguards(cfg config) (*SafeguardError, error) {
+	entries, err := gitStatus(cfg.WorkDir, cfg.StagePaths...)
+	if err != nil {
+		return nil, err
+	}
+
+	var violations []string
+	if cfg.MaxChangedFiles > 0 && len(entries) > cfg.MaxChangedFiles {
+		violations = append(violations, fmt.Sprintf("%d files changed (limit %d)", len(entries), cfg.MaxChangedFiles))
+	}
+
+	if cfg.MaxAddedLines > 0 || cfg.MaxRemovedLines > 0 {
+		added, removed, err := countChangedLines(cfg, entries)
+		if err != nil {
+			return nil, err
+		}
+		if cfg.MaxAddedLines > 0 && added > cfg.MaxAddedLines {
+			violations = append(violations, fmt.Sprintf("%d lines added (limit %d)", added, cfg.MaxAddedLines))
+		}
+		if cfg.MaxRemovedLines > 0 && removed > cfg.MaxRemovedLines {
+			violations = append(violations, fmt.Sprintf("%d lines removed (limit %d)", removed, cfg.MaxRemovedLines))
+		}
+	}
+
+	for _, entry := range entries {
+		for _, p := range entryPaths(entry) {
+			if matchAnyGlob(cfg.ForbiddenPaths, p) {
+				violations = append(violations, fmt.Sprintf("%s matches a forbidden path", p))
+			}
+			if len(cfg.AllowedPaths) > 0 && !matchAnyGlob(cfg.AllowedPaths, p) {
+				violations = append(violations, fmt.Sprintf("%s is outside the allowed paths", p))
+			}
+		}
+	}
+
+	if len(violations) == 0 {
+		return nil, nil
+	}
+	return &SafeguardError{Violations: violations}, nil
+}
+
+// countChangedLines sums added and removed lines for tracked files via
+// `git diff --numstat` and counts untracked files as entirely added. Binary
+// files count as zero lines.
+func countChangedLines(cfg config, entries []statusEntry) (int, int, error) {
+	args := []string{"diff", "--numstat", "HEAD"}
+	if len(cfg.StagePaths) > 0 {
+		args = append(append(args, "--"), cfg.StagePaths...)
+	}
+	out, err := gitOutput(cfg.WorkDir, args...)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to diff changes: %w", err)
+	}
+
+	added, removed := 0, 0
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		fields := strings.SplitN(line, "\t", 3)
+		if len(fields) < 3 {
+			continue
+		}
+		a, _ := strconv.Atoi(fields[0])
+		r, _ := strconv.Atoi(fields[1])
+		added += a
+		removed += r
+	}
+
+	for _, entry := range entries {
+		if entry.Index != '?' {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(cfg.WorkDir, entry.Path))
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to read %s: %w", entry.Path, err)
+		}
+		if bytes.IndexByte(data, 0) >= 0 || len(data) == 0 {
+			continue
+		}
+		added += bytes.Count(data, []byte("\n"))
+		if data[len(data)-1] != '\n' {
+			added++
+		}
+	}
+	return added, removed, nil
+}
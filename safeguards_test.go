@@ -0,0 +1,85 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// safeguardRepo returns a repository with pending changes: a modified text
+// file (+1 -2), an untracked three-line file without a trailing newline, and
+// a modified and an untracked binary file.
+func safeguardRepo(t *testing.T) string {
+	t.Helper()
+	dir := testRepo(t)
+	writeFiles(t, dir, map[string]string{"tracked.txt": "a\nb\nc\n", "image.dat": "\x00\x01"})
+	testGit(t, dir, "add", "--all")
+	testGit(t, dir, "commit", "-q", "-m", "base")
+	writeFiles(t, dir, map[string]string{
+		"tracked.txt":       "a\nx\n",
+		"image.dat":         "\x00\x02",
+		"docs/guide/new.md": "1\n2\n3",
+		"new.bin":           "\x00\x03",
+	})
+	return dir
+}
+
+func TestCountChangedLines(t *testing.T) {
+	dir := safeguardRepo(t)
+	cfg := config{WorkDir: dir}
+	entries, err := gitStatus(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	added, removed, err := countChangedLines(cfg, entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added != 4 || removed != 2 {
+		t.Errorf("countChangedLines() = +%d -%d, want +4 -2", added, removed)
+	}
+}
+
+func TestCheckSafeguards(t *testing.T) {
+	dir := safeguardRepo(t)
+	tests := []struct {
+		name string
+		cfg  config
+		want []string
+	}{
+		{name: "no limits"},
+		{name: "within limits", cfg: config{MaxChangedFiles: 4, MaxAddedLines: 4, MaxRemovedLines: 2}},
+		{name: "too many files", cfg: config{MaxChangedFiles: 3}, want: []string{"4 files changed (limit 3)"}},
+		{
+			name: "too many lines",
+			cfg:  config{MaxAddedLines: 3, MaxRemovedLines: 1},
+			want: []string{"4 lines added (limit 3)", "2 lines removed (limit 1)"},
+		},
+		{name: "forbidden path", cfg: config{ForbiddenPaths: []string{"docs/**"}}, want: []string{"docs/guide/new.md matches a forbidden path"}},
+		{
+			name: "outside allowed paths",
+			cfg:  config{AllowedPaths: []string{"*.txt", "*.dat", "*.bin"}},
+			want: []string{"docs/guide/new.md is outside the allowed paths"},
+		},
+		{
+			name: "excluded paths are not counted",
+			cfg:  config{StagePaths: stagePathspecs(nil, []string{"docs"}), MaxChangedFiles: 3, MaxAddedLines: 1, ForbiddenPaths: []string{"docs/**"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.cfg
+			cfg.WorkDir = dir
+			got, err := CheckSafeguards(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var violations []string
+			if got != nil {
+				violations = got.Violations
+			}
+			if !reflect.DeepEqual(violations, tt.want) {
+				t.Errorf("CheckSafeguards() violations = %q, want %q", violations, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// setupSSH writes the deploy key and known_hosts to private temporary files
+// and sets cfg.SSHCommand so pushes authenticate with the key instead of the
+// token. The returned function removes the files.
+func setupSSH(cfg config) (config, func(), error) {
+	if cfg.SSHKey == "" {
+		return cfg, func() {}, nil
+	}
+
+	var files []string
+	cleanup := func() {
+		for _, f := range files {
+			os.Remove(f)
+		}
+	}
+	write := func(pattern, content string) (string, error) {
+		f, err := os.CreateTemp(os.Getenv("RUNNER_TEMP"), pattern)
+		if err != nil {
+			return "", err
+		}
+		files = append(files, f.Name())
+		// CreateTemp already uses 0600, which ssh requires for keys.
+		if _, err := f.WriteString(strings.TrimSpace(content) + "\n"); err != nil {
+			f.Close()
+			return "", err
+		}
+		return f.Name(), f.Close()
+	}
+
+	keyPath, err := write("deploy-key-*", cfg.SSHKey)
+	if err != nil {
+		cleanup()
+		return cfg, func() {}, fmt.Errorf("failed to write ssh key: %w", err)
+	}
+	knownHostsPath, err := write("known-hosts-*", cfg.SSHKnownHosts)
+	if err != nil {
+		cleanup()
+		return cfg, func() {}, fmt.Errorf("failed to write known hosts: %w", err)
+	}
+
+	cfg.SSHCommand = fmt.Sprintf("ssh -i '%s' -o IdentitiesOnly=yes -o UserKnownHostsFile='%s' -o StrictHostKeyChecking=yes",
+		keyPath, knownHostsPath)
+	return cfg, cleanup, nil
+}
+
+// sshRepoURL is the SSH URL of a GitHub repository.
+func sshRepoURL(owner, repo string) string {
+	return fmt.Sprintf("git@github.com:%s/%s.git", owner, repo)
+}
+
+// originPushURL is where pushes to the repository itself go: over SSH when
+// a deploy key is configured, otherwise over HTTPS with the token.
+func originPushURL(cfg config) string {
+	if cfg.SSHCommand != "" {
+		return sshRepoURL(cfg.RepoOwner, cfg.RepoName)
+	}
+	return repoURL(cfg)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// ChangeSummary groups `git status --porcelain` entries by kind.
+type ChangeSummary struct {
+	Modified  []string
+	Added     []string
+	Deleted   []string
+	Untracked []string
+}
+
+// classifyStatus sorts status entries into modified, added, deleted and
+// untracked files. Renames and copies count as added under their new path.
+func classifyStatus(entries []statusEntry) ChangeSummary {
+	var summary ChangeSummary
+	for _, entry := range entries {
+		switch {
+		case entry.Index == '?' && entry.Worktree == '?':
+			summary.Untracked = append(summary.Untracked, entry.Path)
+		case entry.Index == 'D' || entry.Worktree == 'D':
+			summary.Deleted = append(summary.Deleted, entry.Path)
+		case entry.Index == 'A' || entry.Index == 'R' || entry.Index == 'C':
+			summary.Added = append(summary.Added, entry.Path)
+		default:
+			summary.Modified = append(summary.Modified, entry.Path)
+		}
+	}
+	return summary
+}
+
+// CheckStrict fails when the commands left untracked files outside
+// cfg.AllowedUntracked, so leaked temp files are caught instead of
+// committed.
+func CheckStrict(cfg config) error {
+	entries, err := gitStatus(cfg.WorkDir)
+	if err != nil {
+		return err
+	}
+	summary := classifyStatus(entries)
+	log.Printf("Working tree after commands: %d modified, %d added, %d deleted, %d untracked.\n",
+		len(summary.Modified), len(summary.Added), len(summary.Deleted), len(summary.Untracked))
+
+	var unexpected []string
+	for _, file := range summary.Untracked {
+		if !matchAnyGlob(cfg.AllowedUntracked, file) {
+			unexpected = append(unexpected, file)
+		}
+	}
+	if len(unexpected) == 0 {
+		return nil
+	}
+	return fmt.Errorf("commands left %d untracked files outside the allowed paths:\n  - %s",
+		len(unexpected), strings.Join(unexpected, "\n  - "))
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestClassifyStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		out  string
+		want ChangeSummary
+	}{
+		{name: "empty", out: ""},
+		{name: "untracked", out: "?? tmp/leak.txt\x00", want: ChangeSummary{Untracked: []string{"tmp/leak.txt"}}},
+		{name: "added", out: "A  new.go\x00", want: ChangeSummary{Added: []string{"new.go"}}},
+		{name: "deleted in index", out: "D  old.go\x00", want: ChangeSummary{Deleted: []string{"old.go"}}},
+		{name: "deleted in worktree", out: " D old.go\x00", want: ChangeSummary{Deleted: []string{"old.go"}}},
+		{name: "modified", out: " M main.go\x00MM go.sum\x00", want: ChangeSummary{Modified: []string{"main.go", "go.sum"}}},
+		{
+			name: "renamed",
+			out:  "R  new name.go\x00old name.go\x00 M after.go\x00",
+			want: ChangeSummary{Added: []string{"new name.go"}, Modified: []string{"after.go"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyStatus(parseStatus(tt.out)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("classifyStatus(%q) = %+v, want %+v", tt.out, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseStatusRename(t *testing.T) {
+	got := parseStatus("R  new.go\x00old.go\x00?? x\x00")
+	want := []statusEntry{
+		{Index: 'R', Worktree: ' ', Path: "new.go", OrigPath: "old.go"},
+		{Index: '?', Worktree: '?', Path: "x"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseStatus() = %+v, want %+v", got, want)
+	}
+}
+
+func TestCheckStrict(t *testing.T) {
+	dir := testRepo(t)
+	writeFiles(t, dir, map[string]string{
+		"gen/out.go":      "package gen\n",
+		"gen/sub/out.go":  "package sub\n",
+		"notes.tmp":       "x\n",
+		"cache/state.bin": "x\n",
+	})
+	tests := []struct {
+		name    string
+		allowed []string
+		want    []string
+	}{
+		{name: "nothing allowed", want: []string{"cache/state.bin", "gen/out.go", "gen/sub/out.go", "notes.tmp"}},
+		{name: "directory glob", allowed: []string{"gen/**"}, want: []string{"cache/state.bin", "notes.tmp"}},
+		{name: "single level", allowed: []string{"gen/*.go", "*.tmp"}, want: []string{"cache/state.bin", "gen/sub/out.go"}},
+		{name: "all allowed", allowed: []string{"gen/**", "*.tmp", "cache/**"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckStrict(config{WorkDir: dir, AllowedUntracked: tt.allowed})
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Errorf("CheckStrict() = %v, want nil", err)
+				}
+				return
+			}
+			want := fmt.Sprintf("commands left %d untracked files outside the allowed paths:\n  - %s",
+				len(tt.want), strings.Join(tt.want, "\n  - "))
+			if err == nil || err.Error() != want {
+				t.Errorf("CheckStrict() = %v, want %q", err, want)
+			}
+		})
+	}
+}
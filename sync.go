@@ -0,0 +1,146 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// errMergeHeld means the refreshed PR violates safeguards and was left open
+// without merging.
+var errMergeHeld = errors.New("changes violate safeguards; leaving the pull request open")
+
+// baseHeadSHA returns the current head of the base branch on GitHub.
+func baseHeadSHA(cfg config, client *GitHubClient) (string, error) {
+	branch, err := client.GetBranch(cfg.BaseBranch)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch %s: %w", cfg.BaseBranch, err)
+	}
+	return branch.Commit.SHA, nil
+}
+
+// checkoutLatestBase detaches HEAD at the current tip of the base branch,
+// discarding any leftovers from a previous target, and returns its SHA.
+func checkoutLatestBase(cfg config) (string, error) {
+	if err := runGitRemote(cfg, cfg.WorkDir, "fetch", "origin", cfg.BaseBranch); err != nil {
+		return "", fmt.Errorf("failed to fetch %s: %w", cfg.BaseBranch, err)
+	}
+	if err := runGit(cfg.WorkDir, "checkout", "--force", "--detach", "FETCH_HEAD"); err != nil {
+		return "", fmt.Errorf("failed to check out %s: %w", cfg.BaseBranch, err)
+	}
+	if err := runGit(cfg.WorkDir, "clean", "-fd"); err != nil {
+		return "", fmt.Errorf("failed to clean working tree: %w", err)
+	}
+	return gitHeadSHA(cfg.WorkDir)
+}
+
+// RefreshPullRequest brings the PR up to date with a base branch that moved
+// while CI was running and returns the new head SHA. An empty SHA means the
+// commands produced no changes on the new base and the PR was closed.
+func RefreshPullRequest(cfg config, client *GitHubClient, pr *PullRequest, headSHA, baseSHA string) (string, error) {
+	// Merge PRs have no commands to re-run; merging the new base is the refresh.
+	if cfg.BaseMovedStrategy == "rerun" && cfg.Mode != "merge" {
+		return rerunOnBase(cfg, client, pr, baseSHA)
+	}
+	return updateBranchAndWait(cfg, client, pr, headSHA)
+}
+
+// updateBranchAndWait asks GitHub to merge the base into the PR and waits
+// for the PR head to change.
+func updateBranchAndWait(cfg config, client *GitHubClient, pr *PullRequest, headSHA string) (string, error) {
+	if err := client.UpdatePullRequestBranch(pr.Number, headSHA); err != nil {
+		return "", fmt.Errorf("failed to update PR #%d: %w", pr.Number, err)
+	}
+
+	interval := cfg.CIWaitInterval
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	deadline := time.Now().Add(2 * time.Minute)
+	for {
+		current, err := client.GetPullRequest(pr.Number)
+		if err != nil {
+			return "", fmt.Errorf("failed to fetch PR #%d: %w", pr.Number, err)
+		}
+		if current.Head.Sha != headSHA {
+			return current.Head.Sha, nil
+		}
+		if time.Now().After(deadline) {
+			return "", fmt.Errorf("PR #%d head did not change after update-branch", pr.Number)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// rerunOnBase re-runs the commands on the new base and force-pushes the result
+// over the PR branch. The new changes are checked against the safeguards
+// like the first run's: a violation fails, or with pr-only is pushed and
+// commented on and returns errMergeHeld.
+func rerunOnBase(cfg config, client *GitHubClient, pr *PullRequest, baseSHA string) (string, error) {
+	branchName := pr.Head.Ref
+	if err := runGitRemote(cfg, cfg.WorkDir, "fetch", "origin", cfg.BaseBranch); err != nil {
+		return "", fmt.Errorf("failed to fetch %s: %w", cfg.BaseBranch, err)
+	}
+	if err := runGit(cfg.WorkDir, "checkout", "--force", "-B", branchName, baseSHA); err != nil {
+		return "", fmt.Errorf("failed to reset branch: %w", err)
+	}
+	if err := runGit(cfg.WorkDir, "clean", "-fd"); err != nil {
+		return "", fmt.Errorf("failed to clean working tree: %w", err)
+	}
+
+	cfg.BaseSHA = baseSHA
+	cfg.WorkBranch = branchName
+	if err := RunCommands(cfg); err != nil {
+		return "", err
+	}
+	if cfg.Strict {
+		if err := CheckStrict(cfg); err != nil {
+			return "", err
+		}
+	}
+
+	changed, err := hasChanges(cfg.WorkDir, cfg.StagePaths...)
+	if err != nil {
+		return "", err
+	}
+	if !changed {
+		if err := client.CreateComment(pr.Number, fmt.Sprintf("Commands produce no changes on %s at %s; closing.", cfg.BaseBranch, baseSHA)); err != nil {
+			log.Printf("Failed to comment on PR #%d: %v\n", pr.Number, err)
+		}
+		if err := client.ClosePullRequest(pr.Number); err != nil {
+			return "", fmt.Errorf("failed to close PR #%d: %w", pr.Number, err)
+		}
+		if err := client.DeleteBranch(branchName); err != nil {
+			log.Printf("Failed to delete branch %s: %v\n", branchName, err)
+		}
+		return "", nil
+	}
+
+	safeguardErr, err := CheckSafeguards(cfg)
+	if err != nil {
+		return "", err
+	}
+	if safeguardErr != nil && cfg.SafeguardAction == "fail" {
+		return "", safeguardErr
+	}
+
+	if _, err := commitChanges(cfg); err != nil {
+		return "", err
+	}
+	if err := pushBranch(cfg, branchName, true); err != nil {
+		return "", err
+	}
+	headSHA, err := gitHeadSHA(cfg.WorkDir)
+	if err != nil {
+		return "", err
+	}
+	if safeguardErr != nil {
+		log.Println(safeguardErr)
+		if err := client.CreateComment(pr.Number, redact(safeguardErr.Markdown())); err != nil {
+			log.Printf("Failed to comment on PR #%d: %v\n", pr.Number, err)
+		}
+		return headSHA, errMergeHeld
+	}
+	return headSHA, nil
+}
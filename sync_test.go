@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRerunOnBaseChecksSafeguards(t *testing.T) {
+	tests := []struct {
+		name    string
+		action  string
+		wantErr func(error) bool
+		pushed  bool
+	}{
+		{
+			name:   "fail",
+			action: "fail",
+			wantErr: func(err error) bool {
+				var safeguardErr *SafeguardError
+				return errors.As(err, &safeguardErr)
+			},
+		},
+		{
+			name:    "pr-only",
+			action:  "pr-only",
+			wantErr: func(err error) bool { return errors.Is(err, errMergeHeld) },
+			pushed:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := testRepo(t)
+			origin := t.TempDir()
+			testGit(t, origin, "init", "-q", "--bare")
+			testGit(t, dir, "remote", "add", "origin", origin)
+			testGit(t, dir, "push", "-q", "origin", "HEAD:refs/heads/main")
+			baseSHA := testGit(t, dir, "rev-parse", "HEAD")
+
+			var comments int
+			client := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodPost && r.URL.Path == "/repos/owner/repo/issues/7/comments" {
+					comments++
+				}
+				w.Write([]byte("{}"))
+			})
+
+			cfg := config{
+				WorkDir:         dir,
+				BaseBranch:      "main",
+				PushRemote:      origin,
+				Commands:        []string{"seq 1 10 > generated.txt"},
+				MaxAddedLines:   5,
+				SafeguardAction: tt.action,
+			}
+			pr := &PullRequest{Number: 7}
+			pr.Head.Ref = "auto-merge-1-main"
+
+			headSHA, err := rerunOnBase(cfg, client, pr, baseSHA)
+			if !tt.wantErr(err) {
+				t.Fatalf("rerunOnBase() error = %v", err)
+			}
+
+			remote := testGit(t, origin, "for-each-ref", "--format=%(objectname)", "refs/heads/auto-merge-1-main")
+			if tt.pushed {
+				if headSHA == "" || remote != headSHA {
+					t.Errorf("pushed %q, want head %q", remote, headSHA)
+				}
+				if comments != 1 {
+					t.Errorf("posted %d comments, want 1", comments)
+				}
+			} else if remote != "" {
+				t.Errorf("branch was pushed at %s despite the violation", remote)
+			}
+		})
+	}
+}
+
+func TestRerunOnBaseChecksStrict(t *testing.T) {
+	dir := testRepo(t)
+	origin := t.TempDir()
+	testGit(t, origin, "init", "-q", "--bare")
+	testGit(t, dir, "remote", "add", "origin", origin)
+	testGit(t, dir, "push", "-q", "origin", "HEAD:refs/heads/main")
+	baseSHA := testGit(t, dir, "rev-parse", "HEAD")
+
+	client := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("{}"))
+	})
+	cfg := config{
+		WorkDir:          dir,
+		BaseBranch:       "main",
+		PushRemote:       origin,
+		Commands:         []string{"echo x > out.txt && touch leak.tmp"},
+		Strict:           true,
+		AllowedUntracked: []string{"out.txt"},
+	}
+	pr := &PullRequest{Number: 7}
+	pr.Head.Ref = "auto-merge-1-main"
+
+	if _, err := rerunOnBase(cfg, client, pr, baseSHA); err == nil || !strings.Contains(err.Error(), "leak.tmp") {
+		t.Fatalf("rerunOnBase() error = %v, want leak.tmp reported", err)
+	}
+	if remote := testGit(t, origin, "for-each-ref", "refs/heads/auto-merge-1-main"); remote != "" {
+		t.Errorf("branch was pushed despite the leaked file: %s", remote)
+	}
+}
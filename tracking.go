@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// failureIssueTitle is stable per base branch (and partition) so repeated
+// failures land on one issue.
+func failureIssueTitle(cfg config) string {
+	if cfg.Partition != "" {
+		return fmt.Sprintf("%s Automated merge from %s (%s) is failing", cfg.CommitPrefix, cfg.BaseBranch, cfg.Partition)
+	}
+	return fmt.Sprintf("%s Automated merge from %s is failing", cfg.CommitPrefix, cfg.BaseBranch)
+}
+
+// ReportFailureIssue opens a tracking issue for a failed run, or comments on
+// the existing one when it is already open.
+func ReportFailureIssue(cfg config, client *GitHubClient, runErr error) {
+	stage := "unknown"
+	var stageErr *StageError
+	if errors.As(runErr, &stageErr) {
+		stage = stageErr.Stage
+	}
+	body := failureReport(stage, runErr)
+
+	issue, err := findFailureIssue(cfg, client)
+	if err != nil {
+		log.Printf("Failed to look up tracking issue: %v\n", err)
+		return
+	}
+
+	if issue != nil {
+		if err := client.CreateComment(issue.Number, body); err != nil {
+			log.Printf("Failed to comment on tracking issue #%d: %v\n", issue.Number, err)
+			return
+		}
+		log.Printf("Updated tracking issue #%d.\n", issue.Number)
+		return
+	}
+
+	created, err := client.CreateIssue(failureIssueTitle(cfg), body, []string{cfg.FailureLabel})
+	if err != nil {
+		log.Printf("Failed to open tracking issue: %v\n", err)
+		return
+	}
+	log.Printf("Opened tracking issue #%d (%s).\n", created.Number, created.HTMLURL)
+}
+
+// CloseFailureIssue closes the tracking issue after a successful merge.
+func CloseFailureIssue(cfg config, client *GitHubClient) {
+	issue, err := findFailureIssue(cfg, client)
+	if err != nil {
+		log.Printf("Failed to look up tracking issue: %v\n", err)
+		return
+	}
+	if issue == nil {
+		return
+	}
+
+	body := "Automated merge succeeded; closing."
+	if url := runURL(); url != "" {
+		body = fmt.Sprintf("Automated merge succeeded in %s; closing.", url)
+	}
+	if err := client.CreateComment(issue.Number, body); err != nil {
+		log.Printf("Failed to comment on tracking issue #%d: %v\n", issue.Number, err)
+	}
+	if err := client.CloseIssue(issue.Number); err != nil {
+		log.Printf("Failed to close tracking issue #%d: %v\n", issue.Number, err)
+		return
+	}
+	log.Printf("Closed tracking issue #%d.\n", issue.Number)
+}
+
+func findFailureIssue(cfg config, client *GitHubClient) (*Issue, error) {
+	issues, err := client.ListOpenIssuesWithLabel(cfg.FailureLabel)
+	if err != nil {
+		return nil, err
+	}
+	title := failureIssueTitle(cfg)
+	for i := range issues {
+		if issues[i].Title == title {
+			return &issues[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func failureReport(stage string, runErr error) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "The automated merge failed during the **%s** stage.\n\n", stage)
+	fmt.Fprintf(&b, "```\n%s\n```\n", redact(runErr.Error()))
+	if url := runURL(); url != "" {
+		fmt.Fprintf(&b, "\nRun: %s\n", url)
+	}
+	if sha := os.Getenv("GITHUB_SHA"); sha != "" {
+		fmt.Fprintf(&b, "Commit: %s\n", sha)
+	}
+	return b.String()
+}
+
+// runURL links to the current workflow run when running inside Actions.
+func runURL() string {
+	server := firstNonEmpty(os.Getenv("GITHUB_SERVER_URL"), "https://github.com")
+	repo := os.Getenv("GITHUB_REPOSITORY")
+	runID := os.Getenv("GITHUB_RUN_ID")
+	if repo == "" || runID == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s/%s/actions/runs/%s", server, repo, runID)
+}